@@ -33,6 +33,7 @@ func init() {
 		j := i
 		pools = append(pools, sync.Pool{
 			New: func() interface{} {
+				onMiss(j - 1)
 				buf := make([]byte, j*page+enum.MaxFrameHeaderSize)
 				return &buf
 			},
@@ -59,45 +60,55 @@ func selectIndex(n int) int {
 }
 
 func GetBytes(n int) (rv *[]byte) {
-	if n <= enum.MaxFrameHeaderSize {
-		rv = pools[0].Get().(*[]byte)
-		*rv = (*rv)[:cap(*rv)]
-		return rv
+	index := 0
+	if n > enum.MaxFrameHeaderSize {
+		index = selectIndex(n - enum.MaxFrameHeaderSize - 1)
 	}
 
-	index := selectIndex(n - enum.MaxFrameHeaderSize - 1)
 	if index >= len(pools) {
-		rv := make([]byte, n+enum.MaxFrameHeaderSize)
-		return &rv
+		buf := make([]byte, n+enum.MaxFrameHeaderSize)
+		rv = &buf
+		index = -1
+	} else {
+		rv = pools[index].Get().(*[]byte)
+		*rv = (*rv)[:cap(*rv)]
 	}
 
-	rv = pools[index].Get().(*[]byte)
-	*rv = (*rv)[:cap(*rv)]
+	if flags.Load() != 0 {
+		onGet(rv, index)
+	}
 	return rv
 }
 
+// 返回放回哪个级别, -1表示不能分类, 会被丢掉
+func putIndex(c int) int {
+	if c < page+enum.MaxFrameHeaderSize {
+		return -1
+	}
+
+	index := selectIndex(c - enum.MaxFrameHeaderSize - 1)
+	if (c-enum.MaxFrameHeaderSize)%page != 0 {
+		index--
+	}
+	if index >= len(pools) {
+		return -1
+	}
+	return index
+}
+
 // PutBytes可以接受 不是GetBytes分配出来的内存块
 // 如果不是GetBytes分配出来内存块就移到向下一级移去，每一个索引的数据都是>= page * i + enum.MaxFrameHeaderSize，这样保证取出来的数据是够用的，不会太小。
+// 打开统计或者debug模式(EnableStats, EnableDebug)时, 不能分类丢掉的buffer和重复的PutBytes都会被记录下来
 func PutBytes(bytes *[]byte) {
 	if cap(*bytes) == 0 {
 		return
 	}
-	if cap(*bytes) < page+enum.MaxFrameHeaderSize {
-		return
-	}
-	if cap(*bytes) < enum.MaxFrameHeaderSize {
-		panic("putBytes: bytes is too small")
-	}
 
-	newLen := cap(*bytes) - enum.MaxFrameHeaderSize - 1
-	index := selectIndex(newLen)
-	if (cap(*bytes)-enum.MaxFrameHeaderSize)%page != 0 {
-		index--
-		if index < 0 {
-			return
-		}
+	index := putIndex(cap(*bytes))
+	if flags.Load() != 0 && !onPut(bytes, index) {
+		return
 	}
-	if index >= len(pools) {
+	if index < 0 {
 		return
 	}
 	pools[index].Put(bytes)
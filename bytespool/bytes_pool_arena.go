@@ -0,0 +1,72 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build goexperiment.arenas
+
+package bytespool
+
+import "arena"
+
+// 一个连接一个BytesPool, GetBytes都从arena里面分配, Free的时候一次性释放
+// Free之后从这个BytesPool拿到的内存都不能再用了, 需要留下来的先用Clone拷贝出来
+type BytesPool struct {
+	a     *arena.Arena
+	isSet bool
+}
+
+func New() *BytesPool {
+	return &BytesPool{}
+}
+
+func (p *BytesPool) IsInit() bool {
+	return p.isSet
+}
+
+func (p *BytesPool) Init() {
+	p.a = arena.NewArena()
+	p.isSet = true
+}
+
+// 没有Init或者已经Free了, 使用全局的pool
+func (p *BytesPool) GetBytes(n int) (rv *[]byte) {
+	if p.a == nil {
+		return GetBytes(n)
+	}
+
+	rv = arena.New[[]byte](p.a)
+	*rv = arena.MakeSlice[byte](p.a, n, n)
+	return rv
+}
+
+// arena里面的内存在Free的时候一起释放, 这里什么都不做
+func (p *BytesPool) PutBytes(bytes *[]byte) {
+	if p.a == nil {
+		PutBytes(bytes)
+	}
+}
+
+// 把buf拷贝到arena外面, Free之后还可以继续使用, 不是arena分配的原样返回
+func (p *BytesPool) Clone(buf *[]byte) *[]byte {
+	rv := arena.Clone(*buf)
+	return &rv
+}
+
+func (p *BytesPool) Free() {
+	if p.a == nil {
+		return
+	}
+	p.a.Free()
+	p.a = nil
+	p.isSet = false
+}
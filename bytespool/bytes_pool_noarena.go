@@ -42,3 +42,8 @@ func (p *BytesPool) PutBytes(bytes *[]byte) {
 
 func (p *BytesPool) Free() {
 }
+
+// 和arena版本保持一样的API, 这里的内存本来就不会被Free释放, 原样返回
+func (p *BytesPool) Clone(buf *[]byte) *[]byte {
+	return buf
+}
@@ -1,6 +1,7 @@
 package bytespool
 
 import (
+	"bytes"
 	"testing"
 )
 
@@ -27,3 +28,48 @@ func TestGetBytes(t *testing.T) {
 		})
 	}
 }
+
+// 不带tag和带goexperiment.arenas的时候都要能过
+func Test_BytesPool(t *testing.T) {
+	p := New()
+	if p.IsInit() {
+		t.Fatal("IsInit() = true before Init")
+	}
+	p.Init()
+	if !p.IsInit() {
+		t.Fatal("IsInit() = false after Init")
+	}
+
+	var keep *[]byte
+	for _, n := range []int{0, 1, 14, 1024, 4096 + 14, 100 * 1024} {
+		buf := p.GetBytes(n)
+		if len(*buf) < n {
+			t.Fatalf("n = %d, len = %d", n, len(*buf))
+		}
+		for i := range (*buf)[:n] {
+			(*buf)[i] = byte(i)
+		}
+
+		if n == 1024 {
+			keep = p.Clone(buf)
+			continue
+		}
+		p.PutBytes(buf)
+	}
+	p.Free()
+
+	want := make([]byte, 1024)
+	for i := range want {
+		want[i] = byte(i)
+	}
+	if !bytes.Equal((*keep)[:1024], want) {
+		t.Fatal("cloned buffer was modified after Free")
+	}
+
+	// Free之后还可以继续用, 和全局的pool一样
+	buf := p.GetBytes(10)
+	if len(*buf) < 10 {
+		t.Fatalf("len = %d", len(*buf))
+	}
+	p.PutBytes(buf)
+}
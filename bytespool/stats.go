@@ -0,0 +1,358 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bytespool
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/antlabs/wsutil/enum"
+)
+
+const (
+	flagStats uint32 = 1 << iota
+	flagDebug
+)
+
+// 最多记录多少个最近放回的buffer, 用来检查重复的PutBytes
+const maxRecentPuts = 1 << 16
+
+// 最多保留最近多少次重复的PutBytes
+const maxDoublePuts = 64
+
+// 调用栈最多记录的层数
+const maxStackDepth = 32
+
+// 统计和debug都没有打开的时候, GetBytes/PutBytes只多一次atomic读
+var flags atomic.Uint32
+
+type classCounters struct {
+	gets        atomic.Int64
+	puts        atomic.Int64
+	misses      atomic.Int64
+	outstanding atomic.Int64
+}
+
+var (
+	classes        [maxIndex]classCounters
+	oversized      atomic.Int64
+	oversizedBytes atomic.Int64
+	dropped        atomic.Int64
+	doublePuts     atomic.Int64
+)
+
+// 一个级别的统计
+type ClassStats struct {
+	Size        int   // 这个级别的buffer大小
+	Gets        int64 // GetBytes的次数
+	Puts        int64 // PutBytes放回这个级别的次数
+	Misses      int64 // sync.Pool里面没有, 新分配的次数
+	Outstanding int64 // 取走还没有放回的字节数, 放回的不是GetBytes分配的buffer时可能是负数
+}
+
+type Stats struct {
+	Classes        [maxIndex]ClassStats
+	Oversized      int64 // 超过最大的级别, 不走pool直接分配的次数
+	OversizedBytes int64 // 超过最大级别分配的总字节数
+	Dropped        int64 // PutBytes不能分类, 直接丢掉的次数
+	DoublePuts     int64 // 同一个buffer重复PutBytes的次数, 只有debug模式下才能检查
+}
+
+// 打开或者关闭每个级别的统计
+func EnableStats(on bool) {
+	setFlag(flagStats, on)
+}
+
+// 打开debug模式, 记录每个还没有放回的buffer的调用栈, 检查重复的PutBytes
+// debug模式下没有放回的buffer不会被gc回收, 只在查内存问题的时候打开
+func EnableDebug(on bool) {
+	debug.Lock()
+	if on {
+		debug.outstanding = make(map[*byte]record)
+		debug.puts = make(map[uintptr]record)
+	} else {
+		debug.outstanding = nil
+		debug.puts = nil
+	}
+	debug.doubles = nil
+	setFlag(flagDebug, on)
+	debug.Unlock()
+}
+
+func setFlag(f uint32, on bool) {
+	for {
+		old := flags.Load()
+		n := old &^ f
+		if on {
+			n |= f
+		}
+		if flags.CompareAndSwap(old, n) {
+			return
+		}
+	}
+}
+
+func ReadStats() (s Stats) {
+	for i := range classes {
+		c := &classes[i]
+		s.Classes[i] = ClassStats{
+			Size:        (i+1)*page + enum.MaxFrameHeaderSize,
+			Gets:        c.gets.Load(),
+			Puts:        c.puts.Load(),
+			Misses:      c.misses.Load(),
+			Outstanding: c.outstanding.Load(),
+		}
+	}
+	s.Oversized = oversized.Load()
+	s.OversizedBytes = oversizedBytes.Load()
+	s.Dropped = dropped.Load()
+	s.DoublePuts = doublePuts.Load()
+	return s
+}
+
+// 清空统计, debug模式的记录不受影响
+func ResetStats() {
+	for i := range classes {
+		c := &classes[i]
+		c.gets.Store(0)
+		c.puts.Store(0)
+		c.misses.Store(0)
+		c.outstanding.Store(0)
+	}
+	oversized.Store(0)
+	oversizedBytes.Store(0)
+	dropped.Store(0)
+	doublePuts.Store(0)
+}
+
+// 同一个buffer重复PutBytes的时候调用, 默认是nil, 只计数和记录下来, 用DumpDoublePuts查看
+// 重复的检查是按地址来的, 有很小的概率误报, 想要panic的时候自己设置:
+//
+//	bytespool.OnDoublePut = func(err *bytespool.DoublePutError) { panic(err) }
+//
+// 重复放回的buffer不会再放进pool里面
+var OnDoublePut func(err *DoublePutError)
+
+type DoublePutError struct {
+	Size      int    // cap(buffer)
+	FirstPut  string // 第一次PutBytes的调用栈
+	SecondPut string // 这一次PutBytes的调用栈
+}
+
+func (e *DoublePutError) Error() string {
+	return fmt.Sprintf("bytespool: buffer(cap %d) put twice\nfirst put:\n%s\nsecond put:\n%s", e.Size, e.FirstPut, e.SecondPut)
+}
+
+type record struct {
+	size  int
+	stack []uintptr
+}
+
+type debugState struct {
+	sync.Mutex
+	// GetBytes取走还没有放回的buffer
+	outstanding map[*byte]record
+	// 最近放回的buffer, 用地址做key, 不会让buffer一直不能回收
+	// 被sync.Pool丢掉回收之后, 地址可能被别的内存复用, 所以不是GetBytes分配的buffer有很小的概率误报
+	puts map[uintptr]record
+	// 最近的重复PutBytes
+	doubles []*DoublePutError
+}
+
+var debug debugState
+
+// 调用的时候要持有锁
+func (d *debugState) recordPut(addr uintptr, r record) {
+	if len(d.puts) >= maxRecentPuts {
+		d.puts = make(map[uintptr]record)
+	}
+	d.puts[addr] = r
+}
+
+func callers() []uintptr {
+	var pcs [maxStackDepth]uintptr
+	// 跳过runtime.Callers, callers, onGet/onPut
+	n := runtime.Callers(3, pcs[:])
+	return append([]uintptr(nil), pcs[:n]...)
+}
+
+func formatStack(pcs []uintptr) string {
+	var buf bytes.Buffer
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(&buf, "\t%s\n\t\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			break
+		}
+	}
+	return buf.String()
+}
+
+// sync.Pool里面没有, 新分配了一个, index是级别
+func onMiss(index int) {
+	if flags.Load()&flagStats != 0 {
+		classes[index].misses.Add(1)
+	}
+}
+
+// index < 0 表示超过了最大的级别
+func onGet(buf *[]byte, index int) {
+	f := flags.Load()
+	if f&flagStats != 0 {
+		if index < 0 {
+			oversized.Add(1)
+			oversizedBytes.Add(int64(cap(*buf)))
+		} else {
+			classes[index].gets.Add(1)
+			classes[index].outstanding.Add(int64(cap(*buf)))
+		}
+	}
+
+	if f&flagDebug == 0 || cap(*buf) == 0 {
+		return
+	}
+
+	p := unsafe.SliceData(*buf)
+	r := record{size: cap(*buf), stack: callers()}
+	debug.Lock()
+	if debug.outstanding != nil {
+		delete(debug.puts, uintptr(unsafe.Pointer(p)))
+		debug.outstanding[p] = r
+	}
+	debug.Unlock()
+}
+
+// index < 0 表示不能分类, 会被丢掉
+// 返回false表示是重复的PutBytes, 不能再放进pool里面
+func onPut(buf *[]byte, index int) bool {
+	f := flags.Load()
+	if f&flagDebug != 0 && cap(*buf) != 0 {
+		p := unsafe.SliceData(*buf)
+		addr := uintptr(unsafe.Pointer(p))
+		r := record{size: cap(*buf), stack: callers()}
+
+		debug.Lock()
+		first, double := record{}, false
+		if debug.outstanding != nil {
+			if _, ok := debug.outstanding[p]; ok {
+				delete(debug.outstanding, p)
+			} else {
+				// 没有在outstanding里面, 要么是最近放回过的, 要么不是GetBytes分配的
+				first, double = debug.puts[addr]
+			}
+			if !double {
+				debug.recordPut(addr, r)
+			}
+		}
+		debug.Unlock()
+
+		if double {
+			doublePuts.Add(1)
+			err := &DoublePutError{
+				Size:      r.size,
+				FirstPut:  formatStack(first.stack),
+				SecondPut: formatStack(r.stack),
+			}
+			debug.recordDouble(err)
+			if onDoublePut := OnDoublePut; onDoublePut != nil {
+				onDoublePut(err)
+			}
+			return false
+		}
+	}
+
+	if f&flagStats != 0 {
+		if index < 0 {
+			dropped.Add(1)
+		} else {
+			classes[index].puts.Add(1)
+			classes[index].outstanding.Add(-int64(cap(*buf)))
+		}
+	}
+	return true
+}
+
+// 只保留最近的maxDoublePuts个
+func (d *debugState) recordDouble(err *DoublePutError) {
+	d.Lock()
+	if d.outstanding != nil {
+		if len(d.doubles) >= maxDoublePuts {
+			d.doubles = append(d.doubles[:0], d.doubles[1:]...)
+		}
+		d.doubles = append(d.doubles, err)
+	}
+	d.Unlock()
+}
+
+// 把最近的重复PutBytes和两次的调用栈写到w, 只有debug模式下才有数据
+// 返回的是写了多少个, 总的次数看Stats.DoublePuts
+func DumpDoublePuts(w io.Writer) (n int, err error) {
+	debug.Lock()
+	doubles := append([]*DoublePutError(nil), debug.doubles...)
+	debug.Unlock()
+
+	for _, e := range doubles {
+		if _, err = fmt.Fprintf(w, "%s\n", e.Error()); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// 把还没有放回的buffer按照GetBytes的调用栈分组写到w, 字节数多的在前面
+// 只有debug模式下才有数据, 返回的是还没有放回的buffer个数
+func DumpLeaks(w io.Writer) (n int, err error) {
+	type group struct {
+		count int
+		bytes int
+		stack []uintptr
+	}
+
+	groups := make(map[string]*group)
+	debug.Lock()
+	for _, r := range debug.outstanding {
+		key := fmt.Sprint(r.stack)
+		g := groups[key]
+		if g == nil {
+			g = &group{stack: r.stack}
+			groups[key] = g
+		}
+		g.count++
+		g.bytes += r.size
+		n++
+	}
+	debug.Unlock()
+
+	list := make([]*group, 0, len(groups))
+	for _, g := range groups {
+		list = append(list, g)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].bytes > list[j].bytes })
+
+	for _, g := range list {
+		if _, err = fmt.Fprintf(w, "%d buffers, %d bytes, allocated at:\n%s\n", g.count, g.bytes, formatStack(g.stack)); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bytespool
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_Stats(t *testing.T) {
+	EnableStats(true)
+	defer EnableStats(false)
+	ResetStats()
+
+	var bufs []*[]byte
+	for i := 0; i < 3; i++ {
+		bufs = append(bufs, GetBytes(2000))
+	}
+	PutBytes(bufs[0])
+	PutBytes(bufs[1])
+
+	big := GetBytes((maxIndex + 1) * page)
+	PutBytes(big)
+	small := make([]byte, 100)
+	PutBytes(&small)
+
+	s := ReadStats()
+	c := s.Classes[1]
+	if c.Size != 2*page+14 || c.Gets != 3 || c.Puts != 2 || c.Outstanding != int64(c.Size) {
+		t.Fatalf("class 1: %+v", c)
+	}
+	if c.Misses < 0 || c.Misses > c.Gets {
+		t.Fatalf("class 1 misses: %+v", c)
+	}
+	if s.Oversized != 1 || s.OversizedBytes != int64(cap(*big)) {
+		t.Fatalf("oversized: %d, %d", s.Oversized, s.OversizedBytes)
+	}
+	if s.Dropped != 2 {
+		t.Fatalf("dropped: %d", s.Dropped)
+	}
+
+	ResetStats()
+	if s = ReadStats(); s.Classes[1].Gets != 0 || s.Dropped != 0 {
+		t.Fatalf("after reset: %+v", s.Classes[1])
+	}
+}
+
+func leakBytes() *[]byte {
+	return GetBytes(3000)
+}
+
+func Test_Debug_Leaks(t *testing.T) {
+	EnableDebug(true)
+	defer EnableDebug(false)
+
+	buf := leakBytes()
+	var out strings.Builder
+	n, err := DumpLeaks(&out)
+	if err != nil || n != 1 {
+		t.Fatalf("n = %d, err = %v", n, err)
+	}
+	if !strings.Contains(out.String(), "leakBytes") || !strings.Contains(out.String(), "1 buffers, 3086 bytes") {
+		t.Fatalf("dump:\n%s", out.String())
+	}
+
+	PutBytes(buf)
+	out.Reset()
+	if n, _ = DumpLeaks(&out); n != 0 || out.Len() != 0 {
+		t.Fatalf("n = %d, dump:\n%s", n, out.String())
+	}
+}
+
+func Test_Debug_DoublePut(t *testing.T) {
+	EnableStats(true)
+	EnableDebug(true)
+	var got *DoublePutError
+	old := OnDoublePut
+	OnDoublePut = func(err *DoublePutError) { got = err }
+	defer func() {
+		OnDoublePut = old
+		EnableDebug(false)
+		EnableStats(false)
+	}()
+	ResetStats()
+
+	// 放回之后又被取走, 再放回是正常的
+	for i := 0; i < 4; i++ {
+		PutBytes(GetBytes(1500))
+	}
+	// 不是GetBytes分配的buffer, 放回一次也是正常的
+	foreign := make([]byte, 4096)
+	PutBytes(&foreign)
+	if got != nil {
+		t.Fatalf("unexpected double put: %v", got)
+	}
+
+	buf := GetBytes(1500)
+	PutBytes(buf)
+	PutBytes(buf)
+	if got == nil || got.Size != cap(*buf) || got.FirstPut == "" || got.SecondPut == "" {
+		t.Fatalf("double put not detected: %v", got)
+	}
+	if !strings.Contains(got.Error(), "put twice") {
+		t.Fatal(got.Error())
+	}
+	if s := ReadStats(); s.DoublePuts != 1 {
+		t.Fatalf("DoublePuts = %d", s.DoublePuts)
+	}
+}
+
+// 默认不panic, 计数之后可以用DumpDoublePuts查看两次的调用栈
+func Test_Debug_DoublePut_Default(t *testing.T) {
+	EnableStats(true)
+	EnableDebug(true)
+	defer func() {
+		EnableDebug(false)
+		EnableStats(false)
+	}()
+	ResetStats()
+
+	buf := GetBytes(1500)
+	PutBytes(buf)
+	PutBytes(buf)
+	if s := ReadStats(); s.DoublePuts != 1 {
+		t.Fatalf("DoublePuts = %d", s.DoublePuts)
+	}
+
+	var out strings.Builder
+	n, err := DumpDoublePuts(&out)
+	if err != nil || n != 1 {
+		t.Fatalf("n = %d, err = %v", n, err)
+	}
+	if !strings.Contains(out.String(), "put twice") || !strings.Contains(out.String(), "Test_Debug_DoublePut_Default") {
+		t.Fatalf("dump:\n%s", out.String())
+	}
+}
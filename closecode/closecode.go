@@ -0,0 +1,217 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package closecode
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/antlabs/wsutil/limitreader"
+)
+
+// close frame的状态码
+// https://datatracker.ietf.org/doc/html/rfc6455#section-7.4
+// https://www.iana.org/assignments/websocket/websocket.xhtml#close-code-number
+type StatusCode uint16
+
+const (
+	// 正常关闭
+	NormalClosure StatusCode = 1000
+	// 服务端下线或者浏览器离开页面
+	GoingAway StatusCode = 1001
+	// 协议错误
+	ProtocolError StatusCode = 1002
+	// 收到不能处理的数据类型
+	UnsupportedData StatusCode = 1003
+	// 保留
+	Reserved StatusCode = 1004
+	// 没有状态码, 不能在线路上传输
+	NoStatusReceived StatusCode = 1005
+	// 连接异常断开, 没有收到close frame, 不能在线路上传输
+	AbnormalClosure StatusCode = 1006
+	// 消息的数据和类型不一致, 比如text消息里面不是utf-8
+	InvalidFramePayloadData StatusCode = 1007
+	// 违反策略
+	PolicyViolation StatusCode = 1008
+	// 消息太大
+	MessageTooBig StatusCode = 1009
+	// 客户端期望服务端协商一个或者多个扩展, 但是服务端没有
+	MandatoryExtension StatusCode = 1010
+	// 服务端内部错误
+	InternalServerError StatusCode = 1011
+	// 以下是IANA注册的
+	// 服务重启
+	ServiceRestart StatusCode = 1012
+	// 稍后再试
+	TryAgainLater StatusCode = 1013
+	// 网关收到上游的错误响应
+	BadGateway StatusCode = 1014
+	// TLS握手失败, 不能在线路上传输
+	TLSHandshake StatusCode = 1015
+)
+
+// close frame的payload最大是125字节, 减去2字节的状态码
+const MaxReasonSize = 123
+
+// 解析对端close frame出错时, 直接使用错误里面的状态码关闭连接
+var (
+	ErrInvalidCode        = &CloseError{Code: ProtocolError, Reason: "invalid status code"}
+	ErrReasonTooLong      = &CloseError{Code: ProtocolError, Reason: "reason is longer than 123 bytes"}
+	ErrInvalidUTF8Reason  = &CloseError{Code: InvalidFramePayloadData, Reason: "reason is not valid utf-8"}
+	ErrInvalidPayloadSize = &CloseError{Code: ProtocolError, Reason: "close payload length is 1"}
+)
+
+func (c StatusCode) String() string {
+	switch c {
+	case NormalClosure:
+		return "normal closure"
+	case GoingAway:
+		return "going away"
+	case ProtocolError:
+		return "protocol error"
+	case UnsupportedData:
+		return "unsupported data"
+	case Reserved:
+		return "reserved"
+	case NoStatusReceived:
+		return "no status received"
+	case AbnormalClosure:
+		return "abnormal closure"
+	case InvalidFramePayloadData:
+		return "invalid frame payload data"
+	case PolicyViolation:
+		return "policy violation"
+	case MessageTooBig:
+		return "message too big"
+	case MandatoryExtension:
+		return "mandatory extension"
+	case InternalServerError:
+		return "internal server error"
+	case ServiceRestart:
+		return "service restart"
+	case TryAgainLater:
+		return "try again later"
+	case BadGateway:
+		return "bad gateway"
+	case TLSHandshake:
+		return "tls handshake"
+	}
+	return "status code " + strconv.Itoa(int(c))
+}
+
+// 是否可以出现在close frame里面
+// https://datatracker.ietf.org/doc/html/rfc6455#section-7.4.2
+func (c StatusCode) IsValid() bool {
+	switch {
+	case c >= NormalClosure && c <= UnsupportedData:
+		return true
+	case c >= InvalidFramePayloadData && c <= BadGateway:
+		return true
+	case c >= 3000 && c <= 4999:
+		// 3000-3999 给库和框架用, 4000-4999 私有
+		return true
+	}
+
+	// 1004 1005 1006 1015, 以及其他没有分配的状态码
+	return false
+}
+
+// 生成close frame的payload, 2字节的状态码 + utf-8的reason
+func Encode(code StatusCode, reason string) ([]byte, error) {
+	return AppendEncode(make([]byte, 0, 2+len(reason)), code, reason)
+}
+
+// 同Encode, 结果追加到dst后面, 方便使用bytespool里面的内存
+func AppendEncode(dst []byte, code StatusCode, reason string) ([]byte, error) {
+	if !code.IsValid() {
+		return dst, ErrInvalidCode
+	}
+
+	if len(reason) > MaxReasonSize {
+		return dst, ErrReasonTooLong
+	}
+
+	if !utf8.ValidString(reason) {
+		return dst, ErrInvalidUTF8Reason
+	}
+
+	dst = binary.BigEndian.AppendUint16(dst, uint16(code))
+	return append(dst, reason...), nil
+}
+
+// 解析close frame的payload
+// payload为空时, 返回NoStatusReceived
+// https://datatracker.ietf.org/doc/html/rfc6455#section-5.5.1
+func Decode(payload []byte) (code StatusCode, reason string, err error) {
+	if len(payload) == 0 {
+		return NoStatusReceived, "", nil
+	}
+
+	if len(payload) == 1 {
+		return 0, "", ErrInvalidPayloadSize
+	}
+
+	code = StatusCode(binary.BigEndian.Uint16(payload))
+	if !code.IsValid() {
+		return code, "", ErrInvalidCode
+	}
+
+	if len(payload)-2 > MaxReasonSize {
+		return code, "", ErrReasonTooLong
+	}
+
+	if !utf8.Valid(payload[2:]) {
+		return code, "", ErrInvalidUTF8Reason
+	}
+
+	return code, string(payload[2:]), nil
+}
+
+// CloseError 带状态码的错误
+// 可以表示收到的close frame, 也可以表示需要使用这个状态码关闭连接
+type CloseError struct {
+	Code   StatusCode
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason == "" {
+		return "websocket: close " + strconv.Itoa(int(e.Code)) + " (" + e.Code.String() + ")"
+	}
+	return "websocket: close " + strconv.Itoa(int(e.Code)) + " (" + e.Code.String() + "): " + e.Reason
+}
+
+func (e *CloseError) StatusCode() StatusCode {
+	return e.Code
+}
+
+// 从err里面取出关闭连接需要使用的状态码
+// err实现了StatusCode() StatusCode方法就使用它, 不然就是InternalServerError
+func FromError(err error) StatusCode {
+	if err == nil {
+		return NormalClosure
+	}
+
+	if errors.Is(err, limitreader.ErrTooBigMessage) {
+		return MessageTooBig
+	}
+
+	var sc interface{ StatusCode() StatusCode }
+	if errors.As(err, &sc) {
+		return sc.StatusCode()
+	}
+	return InternalServerError
+}
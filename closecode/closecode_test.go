@@ -0,0 +1,138 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package closecode
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/antlabs/wsutil/limitreader"
+)
+
+func Test_IsValid(t *testing.T) {
+	tests := []struct {
+		code StatusCode
+		want bool
+	}{
+		{code: 0, want: false},
+		{code: 999, want: false},
+		{code: NormalClosure, want: true},
+		{code: UnsupportedData, want: true},
+		{code: Reserved, want: false},
+		{code: NoStatusReceived, want: false},
+		{code: AbnormalClosure, want: false},
+		{code: InvalidFramePayloadData, want: true},
+		{code: InternalServerError, want: true},
+		{code: BadGateway, want: true},
+		{code: TLSHandshake, want: false},
+		{code: 1016, want: false},
+		{code: 2999, want: false},
+		{code: 3000, want: true},
+		{code: 4999, want: true},
+		{code: 5000, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.code.IsValid(); got != tt.want {
+			t.Errorf("%d.IsValid() = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
+
+func Test_EncodeDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    StatusCode
+		reason  string
+		wantErr error
+	}{
+		{name: "normal", code: NormalClosure, reason: "bye"},
+		{name: "empty reason", code: GoingAway},
+		{name: "utf-8 reason", code: 4000, reason: "再见"},
+		{name: "max reason", code: NormalClosure, reason: strings.Repeat("a", MaxReasonSize)},
+		{name: "reason too long", code: NormalClosure, reason: strings.Repeat("a", MaxReasonSize+1), wantErr: ErrReasonTooLong},
+		{name: "1005", code: NoStatusReceived, wantErr: ErrInvalidCode},
+		{name: "1006", code: AbnormalClosure, wantErr: ErrInvalidCode},
+		{name: "1015", code: TLSHandshake, wantErr: ErrInvalidCode},
+		{name: "bad utf-8", code: NormalClosure, reason: "\xff", wantErr: ErrInvalidUTF8Reason},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := Encode(tt.code, tt.reason)
+			if err != tt.wantErr {
+				t.Fatalf("Encode() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			code, reason, err := Decode(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code != tt.code || reason != tt.reason {
+				t.Fatalf("Decode() = %d:%s, want %d:%s", code, reason, tt.code, tt.reason)
+			}
+		})
+	}
+}
+
+func Test_Decode(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  []byte
+		wantCode StatusCode
+		wantErr  error
+	}{
+		{name: "empty", payload: nil, wantCode: NoStatusReceived},
+		{name: "one byte", payload: []byte{0x03}, wantErr: ErrInvalidPayloadSize},
+		{name: "1005 on wire", payload: []byte{0x03, 0xED}, wantErr: ErrInvalidCode},
+		{name: "bad utf-8", payload: []byte{0x03, 0xE8, 0xce, 0xba, 0xe1}, wantErr: ErrInvalidUTF8Reason},
+		{name: "reason too long", payload: append([]byte{0x03, 0xE8}, bytes.Repeat([]byte("a"), 124)...), wantErr: ErrReasonTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, err := Decode(tt.payload)
+			if err != tt.wantErr {
+				t.Fatalf("Decode() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && code != tt.wantCode {
+				t.Fatalf("Decode() code = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func Test_FromError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want StatusCode
+	}{
+		{err: nil, want: NormalClosure},
+		{err: &CloseError{Code: PolicyViolation}, want: PolicyViolation},
+		{err: fmt.Errorf("read: %w", ErrInvalidUTF8Reason), want: InvalidFramePayloadData},
+		{err: limitreader.ErrTooBigMessage, want: MessageTooBig},
+		{err: fmt.Errorf("unknown"), want: InternalServerError},
+	}
+
+	for _, tt := range tests {
+		if got := FromError(tt.err); got != tt.want {
+			t.Errorf("FromError(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// wsconformance 不依赖Autobahn TestSuite, 运行conformance里面的case, 输出Autobahn格式的json报告
+//
+//	go run ./cmd/wsconformance                          # 测试内置的EchoServer
+//	go run ./cmd/wsconformance -url ws://127.0.0.1:9001/ -cases '6.*,7.*' -o index.json
+//
+// 有case没有通过时, 退出码是1
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/antlabs/wsutil/conformance"
+)
+
+func main() {
+	agent := flag.String("agent", "wsutil", "agent name in the report")
+	url := flag.String("url", "", "websocket server to test, empty starts the built-in echo server")
+	cases := flag.String("cases", "", "comma separated case ids, path.Match patterns like 6.* are allowed")
+	out := flag.String("o", "", "report file, empty writes to stdout")
+	timeout := flag.Duration("timeout", conformance.DefaultTimeout, "timeout of each case")
+	flag.Parse()
+
+	var patterns []string
+	if *cases != "" {
+		patterns = strings.Split(*cases, ",")
+	}
+
+	report, err := conformance.Run(conformance.Filter(conformance.Cases(), patterns), conformance.Options{
+		Agent:   *agent,
+		URL:     *url,
+		Timeout: *timeout,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	var buf bytes.Buffer
+	if err = report.WriteJSON(&buf); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if *out == "" {
+		_, err = os.Stdout.Write(buf.Bytes())
+	} else {
+		err = os.WriteFile(*out, buf.Bytes(), 0o644)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	failed := report.Failed()
+	total := 0
+	for _, results := range report {
+		total += len(results)
+	}
+	fmt.Fprintf(os.Stderr, "%d/%d cases passed\n", total-len(failed), total)
+	for _, id := range failed {
+		fmt.Fprintln(os.Stderr, "FAILED", id)
+	}
+	if len(failed) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package conformance
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/antlabs/wsutil/closecode"
+	"github.com/antlabs/wsutil/opcode"
+)
+
+// Frame 测试客户端发出去的一个frame, 不做任何检查, 可以构造出违反协议的数据
+type Frame struct {
+	Fin    bool
+	Rsv1   bool
+	Rsv2   bool
+	Rsv3   bool
+	Opcode opcode.Opcode
+	// 没有mask之前的数据
+	Payload []byte
+
+	// 使用协商好的permessage-deflate压缩Payload, 并且设置RSV1
+	Compress bool
+	// 大于1时, 把Payload(压缩之后的)切成Split个分片, 只有第一个分片带opcode和RSV1
+	Split int
+	// 大于0时, 每次write只写Chop个字节, 测试对端处理半包
+	Chop int
+	// 写完之后等待一段时间
+	Delay time.Duration
+}
+
+// Event 测试客户端从对端收到的东西, 完整的消息或者pong
+type Event struct {
+	Opcode  opcode.Opcode
+	Payload []byte
+}
+
+func (e Event) String() string {
+	if len(e.Payload) > 32 {
+		return fmt.Sprintf("%s(%d bytes)", e.Opcode, len(e.Payload))
+	}
+	return fmt.Sprintf("%s(%q)", e.Opcode, e.Payload)
+}
+
+func (e Event) equal(o Event) bool {
+	return e.Opcode == o.Opcode && bytes.Equal(e.Payload, o.Payload)
+}
+
+// Expect 期望的结果
+type Expect struct {
+	// 按顺序收到的消息和pong
+	Events []Event
+	// 对端close frame里面的状态码, 为空时必须是1000
+	// 对端使用空的close frame时, 状态码是closecode.NoStatusReceived
+	Codes []closecode.StatusCode
+	// 对端不能接受Case.Extensions里面的扩展
+	NoExtension bool
+}
+
+// 是不是期望对端因为错误关闭连接
+func (e *Expect) failing() bool {
+	for _, c := range e.Codes {
+		if c != closecode.NormalClosure && c != closecode.NoStatusReceived {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Expect) codeOK(code closecode.StatusCode) bool {
+	if len(e.Codes) == 0 {
+		return code == closecode.NormalClosure
+	}
+	for _, c := range e.Codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Case 一个测试用例, 编号和Autobahn TestSuite的章节对应
+type Case struct {
+	ID          string
+	Description string
+	Expectation string
+	// 客户端的Sec-WebSocket-Extensions, 空的不协商扩展
+	Extensions string
+	// 按顺序发出去的frame, 没有close frame时, 发完之后会发送close 1000
+	Frames []Frame
+	Expect Expect
+}
+
+// 按编号过滤, patterns使用path.Match的语法, 比如"6.*", 为空时返回所有的case
+func Filter(cases []Case, patterns []string) []Case {
+	if len(patterns) == 0 {
+		return cases
+	}
+
+	var out []Case
+	for _, c := range cases {
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, c.ID); ok {
+				out = append(out, c)
+				break
+			}
+		}
+	}
+	return out
+}
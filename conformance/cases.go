@@ -0,0 +1,494 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package conformance
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/antlabs/wsutil/closecode"
+	"github.com/antlabs/wsutil/opcode"
+)
+
+// 所有的case, 编号和Autobahn TestSuite的章节对应
+// 1 framing, 2 ping/pong, 3 保留位, 4 opcode, 5 分片, 6 utf-8, 7 close, 12/13 permessage-deflate
+func Cases() []Case {
+	var cases []Case
+	cases = append(cases, framingCases()...)
+	cases = append(cases, pingCases()...)
+	cases = append(cases, rsvCases()...)
+	cases = append(cases, opcodeCases()...)
+	cases = append(cases, fragmentCases()...)
+	cases = append(cases, utf8Cases()...)
+	cases = append(cases, closeCases()...)
+	cases = append(cases, deflateCases()...)
+	cases = append(cases, negotiationCases()...)
+	return cases
+}
+
+func dataFrame(op opcode.Opcode, payload []byte) Frame {
+	return Frame{Fin: true, Opcode: op, Payload: payload}
+}
+
+func text(s string) Frame { return dataFrame(opcode.Text, []byte(s)) }
+
+func ping(payload []byte) Frame { return dataFrame(opcode.Ping, payload) }
+
+func closeFrame(payload []byte) Frame { return dataFrame(opcode.Close, payload) }
+
+func closePayload(code uint16, reason string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, code), reason...)
+}
+
+func msg(op opcode.Opcode, payload []byte) Event { return Event{Opcode: op, Payload: payload} }
+
+func pong(payload []byte) Event { return Event{Opcode: opcode.Pong, Payload: payload} }
+
+func protocolError() []closecode.StatusCode {
+	return []closecode.StatusCode{closecode.ProtocolError}
+}
+
+func invalidData() []closecode.StatusCode {
+	return []closecode.StatusCode{closecode.InvalidFramePayloadData}
+}
+
+// 1.x 不同长度的text和binary消息, 覆盖7位, 16位, 64位长度
+func framingCases() (cases []Case) {
+	sizes := []int{0, 125, 126, 127, 128, 65535, 65536}
+	for i, op := range []opcode.Opcode{opcode.Text, opcode.Binary} {
+		fill := byte('*')
+		if op == opcode.Binary {
+			fill = 0xfe
+		}
+
+		for j, n := range sizes {
+			payload := bytes.Repeat([]byte{fill}, n)
+			cases = append(cases, Case{
+				ID:          fmt.Sprintf("1.%d.%d", i+1, j+1),
+				Description: fmt.Sprintf("Send %s message with payload length %d.", op, n),
+				Expectation: "Receive echo'ed message.",
+				Frames:      []Frame{dataFrame(op, payload)},
+				Expect:      Expect{Events: []Event{msg(op, payload)}},
+			})
+		}
+
+		payload := bytes.Repeat([]byte{fill}, 65536)
+		f := dataFrame(op, payload)
+		f.Chop = 997
+		cases = append(cases, Case{
+			ID:          fmt.Sprintf("1.%d.%d", i+1, len(sizes)+1),
+			Description: fmt.Sprintf("Send %s message with payload length 65536, sent out in chops of 997 octets.", op),
+			Expectation: "Receive echo'ed message.",
+			Frames:      []Frame{f},
+			Expect:      Expect{Events: []Event{msg(op, payload)}},
+		})
+	}
+	return cases
+}
+
+// 2.x ping和pong
+func pingCases() []Case {
+	hello := []byte("Hello, world!")
+	bin := []byte{0x00, 0xff, 0xfe, 0xfd, 0xfc, 0xfb, 0x00, 0xff}
+	p125 := bytes.Repeat([]byte{0xfe}, 125)
+	p126 := bytes.Repeat([]byte{0xfe}, 126)
+
+	chopped := ping(p125)
+	chopped.Chop = 1
+
+	var pings []Frame
+	var pongs []Event
+	for i := 0; i < 10; i++ {
+		payload := []byte(fmt.Sprintf("payload-%d", i))
+		pings = append(pings, ping(payload))
+		pongs = append(pongs, pong(payload))
+	}
+	choppedPings := append([]Frame(nil), pings...)
+	for i := range choppedPings {
+		choppedPings[i].Chop = 1
+	}
+
+	return []Case{
+		{ID: "2.1", Description: "Send ping without payload.", Expectation: "Pong (with empty payload) is sent in reply to Ping.",
+			Frames: []Frame{ping(nil)}, Expect: Expect{Events: []Event{pong([]byte{})}}},
+		{ID: "2.2", Description: "Send ping with small text payload.", Expectation: "Pong with payload echo'ed is sent in reply to Ping.",
+			Frames: []Frame{ping(hello)}, Expect: Expect{Events: []Event{pong(hello)}}},
+		{ID: "2.3", Description: "Send ping with small binary (non UTF-8) payload.", Expectation: "Pong with payload echo'ed is sent in reply to Ping.",
+			Frames: []Frame{ping(bin)}, Expect: Expect{Events: []Event{pong(bin)}}},
+		{ID: "2.4", Description: "Send ping with binary payload of 125 octets.", Expectation: "Pong with payload echo'ed is sent in reply to Ping.",
+			Frames: []Frame{ping(p125)}, Expect: Expect{Events: []Event{pong(p125)}}},
+		{ID: "2.5", Description: "Send ping with binary payload of 126 octets.", Expectation: "Connection is failed immediately (1002/Protocol Error), since control frames are only allowed to have payload up to and including 125 octets.",
+			Frames: []Frame{ping(p126)}, Expect: Expect{Codes: protocolError()}},
+		{ID: "2.6", Description: "Send ping with binary payload of 125 octets, send in octet-wise chops.", Expectation: "Pong with payload echo'ed is sent in reply to Ping.",
+			Frames: []Frame{chopped}, Expect: Expect{Events: []Event{pong(p125)}}},
+		{ID: "2.7", Description: "Send unsolicited pong without payload.", Expectation: "Nothing.",
+			Frames: []Frame{dataFrame(opcode.Pong, nil)}},
+		{ID: "2.8", Description: "Send unsolicited pong with payload.", Expectation: "Nothing.",
+			Frames: []Frame{dataFrame(opcode.Pong, []byte("unsolicited pong payload"))}},
+		{ID: "2.9", Description: "Send unsolicited pong with payload, then ping with payload.", Expectation: "Pong for our Ping is sent.",
+			Frames: []Frame{dataFrame(opcode.Pong, []byte("unsolicited pong payload")), ping([]byte("ping payload"))},
+			Expect: Expect{Events: []Event{pong([]byte("ping payload"))}}},
+		{ID: "2.10", Description: "Send 10 pings with payload.", Expectation: "Pongs for our Pings with all the payloads.",
+			Frames: pings, Expect: Expect{Events: pongs}},
+		{ID: "2.11", Description: "Send 10 pings with payload, each in octet-wise chops.", Expectation: "Pongs for our Pings with all the payloads.",
+			Frames: choppedPings, Expect: Expect{Events: pongs}},
+	}
+}
+
+// 3.x 没有协商扩展的时候设置了RSV
+func rsvCases() []Case {
+	hello := []byte("Hello, world!")
+	withRsv := func(f Frame, rsv int) Frame {
+		f.Rsv1, f.Rsv2, f.Rsv3 = rsv&4 != 0, rsv&2 != 0, rsv&1 != 0
+		return f
+	}
+
+	chop := func(frames ...Frame) []Frame {
+		for i := range frames {
+			frames[i].Chop = 1
+		}
+		return frames
+	}
+
+	echoThenFail := func(rsv int) []Frame {
+		return []Frame{text(string(hello)), withRsv(text(string(hello)), rsv), ping(hello)}
+	}
+
+	return []Case{
+		{ID: "3.1", Description: "Send small text message with RSV = 1.", Expectation: "The connection is failed immediately (1002/protocol error), since RSV must be 0, when no extension defining RSV meaning has been negotiated.",
+			Frames: []Frame{withRsv(text(string(hello)), 1)}, Expect: Expect{Codes: protocolError()}},
+		{ID: "3.2", Description: "Send small text message, then send again with RSV = 2, then send Ping.", Expectation: "Echo for first message is received, but then connection is failed immediately.",
+			Frames: echoThenFail(2), Expect: Expect{Events: []Event{msg(opcode.Text, hello)}, Codes: protocolError()}},
+		{ID: "3.3", Description: "Send small text message, then send again with RSV = 3, then send Ping. Octets are sent in frame-wise chops.", Expectation: "Echo for first message is received, but then connection is failed immediately.",
+			Frames: chop(echoThenFail(3)...), Expect: Expect{Events: []Event{msg(opcode.Text, hello)}, Codes: protocolError()}},
+		{ID: "3.4", Description: "Send small text message, then send again with RSV = 4, then send Ping.", Expectation: "Echo for first message is received, but then connection is failed immediately.",
+			Frames: echoThenFail(4), Expect: Expect{Events: []Event{msg(opcode.Text, hello)}, Codes: protocolError()}},
+		{ID: "3.5", Description: "Send small binary message with RSV = 5.", Expectation: "The connection is failed immediately, since RSV must be 0.",
+			Frames: []Frame{withRsv(dataFrame(opcode.Binary, []byte{0x00, 0xff, 0xfe}), 5)}, Expect: Expect{Codes: protocolError()}},
+		{ID: "3.6", Description: "Send Ping with RSV = 6.", Expectation: "The connection is failed immediately, since RSV must be 0.",
+			Frames: []Frame{withRsv(ping(hello), 6)}, Expect: Expect{Codes: protocolError()}},
+		{ID: "3.7", Description: "Send Close with RSV = 7.", Expectation: "The connection is failed immediately, since RSV must be 0.",
+			Frames: []Frame{withRsv(closeFrame(closePayload(1000, "")), 7)}, Expect: Expect{Codes: protocolError()}},
+	}
+}
+
+// 4.x 保留的opcode
+func opcodeCases() (cases []Case) {
+	hello := []byte("Hello, world!")
+	for i, op := range []opcode.Opcode{3, 4, 5, 6, 7, 11, 12, 13, 14, 15} {
+		section, n := 1, i+1
+		kind := "non-control"
+		if op.IsControl() {
+			section, n, kind = 2, i-4, "control"
+		}
+
+		cases = append(cases, Case{
+			ID:          fmt.Sprintf("4.%d.%d", section, n),
+			Description: fmt.Sprintf("Send small text message, then send frame with reserved %s Opcode = %d and non-empty payload, then send Ping.", kind, op),
+			Expectation: "Echo for first message is received, but then connection is failed immediately, since reserved opcode frame is used.",
+			Frames:      []Frame{text(string(hello)), dataFrame(op, hello), ping(hello)},
+			Expect:      Expect{Events: []Event{msg(opcode.Text, hello)}, Codes: protocolError()},
+		})
+	}
+	return cases
+}
+
+func fragment(op opcode.Opcode, fin bool, s string) Frame {
+	return Frame{Fin: fin, Opcode: op, Payload: []byte(s)}
+}
+
+// 5.x 分片
+func fragmentCases() []Case {
+	f12 := []byte("fragment1fragment2")
+	two := func(op opcode.Opcode, chop int, delay time.Duration) []Frame {
+		frames := []Frame{fragment(op, false, "fragment1"), fragment(opcode.Continuation, true, "fragment2")}
+		for i := range frames {
+			frames[i].Chop = chop
+			frames[i].Delay = delay
+		}
+		return frames
+	}
+	withPing := func(chop int) []Frame {
+		frames := []Frame{fragment(opcode.Text, false, "fragment1"), ping([]byte("ping")), fragment(opcode.Continuation, true, "fragment2")}
+		for i := range frames {
+			frames[i].Chop = chop
+		}
+		return frames
+	}
+
+	many := Frame{Fin: true, Opcode: opcode.Text, Payload: []byte(strings.Repeat("fragment", 16)), Split: 128}
+
+	return []Case{
+		{ID: "5.1", Description: "Send Ping fragmented into 2 fragments.", Expectation: "Connection is failed immediately, since control message MUST NOT be fragmented.",
+			Frames: []Frame{fragment(opcode.Ping, false, "fragment1"), fragment(opcode.Continuation, true, "fragment2")}, Expect: Expect{Codes: protocolError()}},
+		{ID: "5.2", Description: "Send Pong fragmented into 2 fragments.", Expectation: "Connection is failed immediately, since control message MUST NOT be fragmented.",
+			Frames: []Frame{fragment(opcode.Pong, false, "fragment1"), fragment(opcode.Continuation, true, "fragment2")}, Expect: Expect{Codes: protocolError()}},
+		{ID: "5.3", Description: "Send text Message fragmented into 2 fragments.", Expectation: "Message is processed and echo'ed back to us.",
+			Frames: two(opcode.Text, 0, 0), Expect: Expect{Events: []Event{msg(opcode.Text, f12)}}},
+		{ID: "5.4", Description: "Send text Message fragmented into 2 fragments, octets are sent in octet-wise chops.", Expectation: "Message is processed and echo'ed back to us.",
+			Frames: two(opcode.Text, 1, 0), Expect: Expect{Events: []Event{msg(opcode.Text, f12)}}},
+		{ID: "5.5", Description: "Send text Message fragmented into 2 fragments, with a short delay after each fragment.", Expectation: "Message is processed and echo'ed back to us.",
+			Frames: two(opcode.Text, 0, 10*time.Millisecond), Expect: Expect{Events: []Event{msg(opcode.Text, f12)}}},
+		{ID: "5.6", Description: "Send text Message fragmented into 2 fragments, one ping with payload in-between.", Expectation: "A pong is received, then the message is echo'ed back to us.",
+			Frames: withPing(0), Expect: Expect{Events: []Event{pong([]byte("ping")), msg(opcode.Text, f12)}}},
+		{ID: "5.7", Description: "Send text Message fragmented into 2 fragments, one ping with payload in-between. Octets are sent in octet-wise chops.", Expectation: "A pong is received, then the message is echo'ed back to us.",
+			Frames: withPing(1), Expect: Expect{Events: []Event{pong([]byte("ping")), msg(opcode.Text, f12)}}},
+		{ID: "5.8", Description: "Send binary Message fragmented into 2 fragments.", Expectation: "Message is processed and echo'ed back to us.",
+			Frames: two(opcode.Binary, 0, 0), Expect: Expect{Events: []Event{msg(opcode.Binary, f12)}}},
+		{ID: "5.9", Description: "Send unfragmented Text Message after Continuation Frame with FIN = true, where there is nothing to continue.", Expectation: "The connection is failed immediately, since there is no message to continue.",
+			Frames: []Frame{fragment(opcode.Continuation, true, "non-continuation payload"), text("Hello, world!")}, Expect: Expect{Codes: protocolError()}},
+		{ID: "5.10", Description: "Send unfragmented Text Message after Continuation Frame with FIN = false, where there is nothing to continue.", Expectation: "The connection is failed immediately, since there is no message to continue.",
+			Frames: []Frame{fragment(opcode.Continuation, false, "non-continuation payload"), text("Hello, world!")}, Expect: Expect{Codes: protocolError()}},
+		{ID: "5.11", Description: "Send text Message fragmented into 2 fragments, then Continuation Frame with FIN = false where there is nothing to continue, then unfragmented Text Message.", Expectation: "The connection is failed immediately, since there is no message to continue.",
+			Frames: append(two(opcode.Text, 0, 0), fragment(opcode.Continuation, false, "fragment3"), text("Hello, world!")),
+			Expect: Expect{Events: []Event{msg(opcode.Text, f12)}, Codes: protocolError()}},
+		{ID: "5.12", Description: "Send text Message fragmented into 2 fragments, where the second one is a text frame instead of a continuation frame.", Expectation: "The connection is failed immediately, since a new data message starts before the previous one is finished.",
+			Frames: []Frame{fragment(opcode.Text, false, "fragment1"), fragment(opcode.Text, true, "fragment2")}, Expect: Expect{Codes: protocolError()}},
+		{ID: "5.13", Description: "Send text Message fragmented into 128 fragments of 1 octet.", Expectation: "Message is processed and echo'ed back to us.",
+			Frames: []Frame{many}, Expect: Expect{Events: []Event{msg(opcode.Text, many.Payload)}}},
+		{ID: "5.14", Description: "Send text Message fragmented into 3 empty fragments.", Expectation: "Message is processed and echo'ed back to us.",
+			Frames: []Frame{fragment(opcode.Text, false, ""), fragment(opcode.Continuation, false, ""), fragment(opcode.Continuation, true, "")},
+			Expect: Expect{Events: []Event{msg(opcode.Text, []byte{})}}},
+	}
+}
+
+// 6.x utf-8
+func utf8Cases() (cases []Case) {
+	valid := []string{
+		"",
+		"Hello-µ@ßöäüàá-UTF-8!!",
+		"κόσμε",
+		"\xf0\x9f\x98\x80",
+		"\xef\xbf\xbf",
+		"\xf4\x8f\xbf\xbf",
+		"\xee\x80\x80",
+	}
+	for i, s := range valid {
+		whole, split, chopped := text(s), text(s), text(s)
+		split.Split = len(s)
+		chopped.Chop = 1
+		for j, f := range []Frame{whole, split, chopped} {
+			how := [...]string{"as one frame", "fragmented into frames of 1 octet", "in octet-wise chops"}[j]
+			cases = append(cases, Case{
+				ID:          fmt.Sprintf("6.1.%d", i*3+j+1),
+				Description: fmt.Sprintf("Send valid UTF-8 text message %q %s.", s, how),
+				Expectation: "The message is echo'ed back to us.",
+				Frames:      []Frame{f},
+				Expect:      Expect{Events: []Event{msg(opcode.Text, []byte(s))}},
+			})
+		}
+	}
+
+	invalid := []string{
+		"\xce\xba\xe1\xbd\xb9\xcf\x83\xce\xbc\xce\xb5\xed\xa0\x80\x65\x64\x69\x74\x65\x64",
+		"\xc0\xaf",
+		"\xe0\x80\xaf",
+		"\xed\xa0\x80",
+		"\xed\xbf\xbf",
+		"\xf4\x90\x80\x80",
+		"\xf8\x88\x80\x80\x80",
+		"\xfe",
+		"\xff",
+		"\x80",
+		"\xc2",
+		"\xce\xba\xe1\xbd",
+	}
+	for i, s := range invalid {
+		whole, split := text(s), text(s)
+		split.Split = len(s)
+		for j, f := range []Frame{whole, split} {
+			how := [...]string{"as one frame", "fragmented into frames of 1 octet"}[j]
+			cases = append(cases, Case{
+				ID:          fmt.Sprintf("6.2.%d", i*2+j+1),
+				Description: fmt.Sprintf("Send invalid UTF-8 text message %q %s.", s, how),
+				Expectation: "The connection is failed immediately, since the payload is not valid UTF-8.",
+				Frames:      []Frame{f},
+				Expect:      Expect{Codes: invalidData()},
+			})
+		}
+	}
+
+	// 第一个分片是合法的, 第二个分片一开始就不合法, 不用等消息收完就可以断开
+	cases = append(cases, Case{
+		ID:          "6.3.1",
+		Description: "Send a text message in 3 fragments, where the 2nd fragment starts with an invalid code point. There is a delay after each fragment.",
+		Expectation: "The connection is failed immediately, since the payload is not valid UTF-8.",
+		Frames: []Frame{
+			{Opcode: opcode.Text, Payload: []byte("κόσμε"), Delay: 20 * time.Millisecond},
+			{Opcode: opcode.Continuation, Payload: []byte("\xf4\x90\x80\x80"), Delay: 20 * time.Millisecond},
+			{Fin: true, Opcode: opcode.Continuation, Payload: []byte("edited")},
+		},
+		Expect: Expect{Codes: invalidData()},
+	})
+	return cases
+}
+
+// 7.x close
+func closeCases() (cases []Case) {
+	hello := []byte("Hello, world!")
+	c1000 := closePayload(1000, "")
+	normal := []closecode.StatusCode{closecode.NormalClosure}
+
+	cases = append(cases, []Case{
+		{ID: "7.1.1", Description: "Send a message followed by a close frame.", Expectation: "Echoed message followed by clean close with normal code.",
+			Frames: []Frame{text(string(hello)), closeFrame(c1000)}, Expect: Expect{Events: []Event{msg(opcode.Text, hello)}, Codes: normal}},
+		{ID: "7.1.2", Description: "Send two close frames.", Expectation: "Clean close with normal code. Second close frame ignored.",
+			Frames: []Frame{closeFrame(c1000), closeFrame(c1000)}, Expect: Expect{Codes: normal}},
+		{ID: "7.1.3", Description: "Send a ping after close message.", Expectation: "Clean close with normal code, no pong.",
+			Frames: []Frame{closeFrame(c1000), ping(hello)}, Expect: Expect{Codes: normal}},
+		{ID: "7.1.4", Description: "Send text message after sending a close frame.", Expectation: "Clean close with normal code. Text message ignored.",
+			Frames: []Frame{closeFrame(c1000), text(string(hello))}, Expect: Expect{Codes: normal}},
+		{ID: "7.1.5", Description: "Send message fragment1 followed by close then fragment.", Expectation: "Clean close with normal code.",
+			Frames: []Frame{fragment(opcode.Text, false, "fragment1"), closeFrame(c1000), fragment(opcode.Continuation, true, "fragment2")}, Expect: Expect{Codes: normal}},
+		{ID: "7.3.1", Description: "Send a close frame with payload length 0 (no close code, no close reason).", Expectation: "Clean close with normal code or an empty close frame.",
+			Frames: []Frame{closeFrame(nil)}, Expect: Expect{Codes: []closecode.StatusCode{closecode.NoStatusReceived, closecode.NormalClosure}}},
+		{ID: "7.3.2", Description: "Send a close frame with payload length 1.", Expectation: "Clean close with protocol error or drop TCP.",
+			Frames: []Frame{closeFrame([]byte{0x03})}, Expect: Expect{Codes: protocolError()}},
+		{ID: "7.3.3", Description: "Send a close frame with close code and no close reason.", Expectation: "Clean close with normal code.",
+			Frames: []Frame{closeFrame(c1000)}, Expect: Expect{Codes: normal}},
+		{ID: "7.3.4", Description: "Send a close frame with close code and close reason of maximum length (123).", Expectation: "Clean close with normal code.",
+			Frames: []Frame{closeFrame(closePayload(1000, strings.Repeat("*", 123)))}, Expect: Expect{Codes: normal}},
+		{ID: "7.3.5", Description: "Send a close frame with close code and close reason which is too long (124) - total frame payload 126 octets.", Expectation: "Clean close with protocol error code or dropped TCP connection.",
+			Frames: []Frame{closeFrame(closePayload(1000, strings.Repeat("*", 124)))}, Expect: Expect{Codes: protocolError()}},
+		{ID: "7.5.1", Description: "Send a close frame with invalid UTF-8 payload.", Expectation: "Clean close with protocol error or invalid utf-8 code or dropped TCP.",
+			Frames: []Frame{closeFrame(closePayload(1000, "\xce\xba\xe1\xbd\xb9\xcf\x83\xce\xbc\xce\xb5\xed\xa0\x80\x65\x64\x69\x74\x65\x64"))},
+			Expect: Expect{Codes: []closecode.StatusCode{closecode.ProtocolError, closecode.InvalidFramePayloadData}}},
+	}...)
+
+	for i, code := range []uint16{1000, 1001, 1002, 1003, 1007, 1008, 1009, 1010, 1011, 3000, 3999, 4000, 4999} {
+		cases = append(cases, Case{
+			ID:          fmt.Sprintf("7.7.%d", i+1),
+			Description: fmt.Sprintf("Send close with valid close code %d.", code),
+			Expectation: "Clean close with normal or echo'ed code.",
+			Frames:      []Frame{closeFrame(closePayload(code, ""))},
+			Expect:      Expect{Codes: []closecode.StatusCode{closecode.StatusCode(code), closecode.NormalClosure}},
+		})
+	}
+
+	for i, code := range []uint16{0, 999, 1004, 1005, 1006, 1015, 1016, 1100, 2000, 2999, 5000, 65535} {
+		cases = append(cases, Case{
+			ID:          fmt.Sprintf("7.9.%d", i+1),
+			Description: fmt.Sprintf("Send close with invalid close code %d.", code),
+			Expectation: "Clean close with protocol error code or drop TCP.",
+			Frames:      []Frame{closeFrame(closePayload(code, ""))},
+			Expect:      Expect{Codes: protocolError()},
+		})
+	}
+	return cases
+}
+
+// 客户端的permessage-deflate offer, 12.x和13.x共用
+var deflateOffers = []string{
+	"permessage-deflate",
+	"permessage-deflate; client_no_context_takeover",
+	"permessage-deflate; server_no_context_takeover",
+	"permessage-deflate; client_max_window_bits",
+	"permessage-deflate; client_max_window_bits=9; server_max_window_bits=9",
+	"permessage-deflate; client_max_window_bits; server_max_window_bits=8",
+	"permessage-deflate; client_max_window_bits=15; server_max_window_bits=15; client_no_context_takeover; server_no_context_takeover",
+}
+
+// 可以压缩的文本, 同一个seed生成的数据一样
+func compressible(n int, seed int64) []byte {
+	words := []string{"websocket", "frame", "deflate", "context", "takeover", "window", "message", "payload", "{\"id\":", "},", "\n"}
+	r := rand.New(rand.NewSource(seed))
+	var b bytes.Buffer
+	for b.Len() < n {
+		b.WriteString(words[r.Intn(len(words))])
+		b.WriteByte(' ')
+	}
+	return b.Bytes()[:n]
+}
+
+// 12.x 每种offer, 不同大小的消息, 发送10个压缩过的消息
+func deflateCases() (cases []Case) {
+	sizes := []int{16, 64, 256, 1024, 4096, 32768}
+	for i, offer := range deflateOffers {
+		for j, n := range sizes {
+			var frames []Frame
+			var events []Event
+			for k := 0; k < 10; k++ {
+				op := opcode.Text
+				if k%2 == 1 {
+					op = opcode.Binary
+				}
+				payload := compressible(n, int64(n*10+k))
+				frames = append(frames, Frame{Fin: true, Opcode: op, Payload: payload, Compress: true})
+				events = append(events, msg(op, payload))
+			}
+
+			cases = append(cases, Case{
+				ID:          fmt.Sprintf("12.%d.%d", i+1, j+1),
+				Description: fmt.Sprintf("Offer %q, send 10 compressed messages of %d octets.", offer, n),
+				Expectation: "Extension is accepted, all messages are echo'ed back and can be decompressed with the negotiated parameters.",
+				Extensions:  offer,
+				Frames:      frames,
+				Expect:      Expect{Events: events},
+			})
+		}
+	}
+	return cases
+}
+
+// 13.x 协商失败的offer, 以及压缩的消息里面的错误
+func negotiationCases() []Case {
+	hello := []byte("Hello, world!")
+	plain := []Frame{text(string(hello))}
+	echo := []Event{msg(opcode.Text, hello)}
+
+	compressed := func(payload []byte) Frame {
+		return Frame{Fin: true, Opcode: opcode.Text, Payload: payload, Compress: true}
+	}
+	big := compressible(4096, 1)
+	split := compressed(big)
+	split.Split = 5
+
+	rsvPing := ping(hello)
+	rsvPing.Rsv1 = true
+	rsvCont := []Frame{fragment(opcode.Text, false, "fragment1"), fragment(opcode.Continuation, true, "fragment2")}
+	rsvCont[1].Rsv1 = true
+
+	offer := deflateOffers[0]
+	return []Case{
+		{ID: "13.1.1", Description: "Offer permessage-deflate with server_max_window_bits=7.", Expectation: "Extension is declined, messages are echo'ed uncompressed.",
+			Extensions: "permessage-deflate; server_max_window_bits=7", Frames: plain, Expect: Expect{Events: echo, NoExtension: true}},
+		{ID: "13.1.2", Description: "Offer permessage-deflate with client_max_window_bits=16.", Expectation: "Extension is declined, messages are echo'ed uncompressed.",
+			Extensions: "permessage-deflate; client_max_window_bits=16", Frames: plain, Expect: Expect{Events: echo, NoExtension: true}},
+		{ID: "13.1.3", Description: "Offer permessage-deflate with an unknown parameter.", Expectation: "Extension is declined, messages are echo'ed uncompressed.",
+			Extensions: "permessage-deflate; foo=1", Frames: plain, Expect: Expect{Events: echo, NoExtension: true}},
+		{ID: "13.1.4", Description: "Offer permessage-deflate with a duplicated parameter.", Expectation: "Extension is declined, messages are echo'ed uncompressed.",
+			Extensions: "permessage-deflate; server_no_context_takeover; server_no_context_takeover", Frames: plain, Expect: Expect{Events: echo, NoExtension: true}},
+		{ID: "13.1.5", Description: "Offer an invalid permessage-deflate followed by a valid fallback offer.", Expectation: "The fallback offer is accepted, compressed messages are echo'ed.",
+			Extensions: "permessage-deflate; server_max_window_bits=7, permessage-deflate; client_max_window_bits", Frames: []Frame{compressed(hello)}, Expect: Expect{Events: echo}},
+		{ID: "13.1.6", Description: "Offer an unknown extension followed by permessage-deflate.", Expectation: "Only permessage-deflate is accepted, compressed messages are echo'ed.",
+			Extensions: "x-unknown-extension, permessage-deflate", Frames: []Frame{compressed(hello)}, Expect: Expect{Events: echo}},
+		{ID: "13.2.1", Description: "Send a compressed message split into 5 fragments.", Expectation: "Message is decompressed and echo'ed back to us.",
+			Extensions: offer, Frames: []Frame{split}, Expect: Expect{Events: []Event{msg(opcode.Text, big)}}},
+		{ID: "13.2.2", Description: "Send an empty compressed message.", Expectation: "Empty message is echo'ed back to us.",
+			Extensions: offer, Frames: []Frame{compressed([]byte{})}, Expect: Expect{Events: []Event{msg(opcode.Text, []byte{})}}},
+		{ID: "13.2.3", Description: "Send an uncompressed message between compressed messages.", Expectation: "All messages are echo'ed back to us.",
+			Extensions: "permessage-deflate; client_max_window_bits", Frames: []Frame{compressed(big), text(string(hello)), compressed(big)},
+			Expect: Expect{Events: []Event{msg(opcode.Text, big), msg(opcode.Text, hello), msg(opcode.Text, big)}}},
+		{ID: "13.3.1", Description: "Send a ping with RSV1 set after negotiating permessage-deflate.", Expectation: "The connection is failed immediately, since control frames must not be compressed.",
+			Extensions: offer, Frames: []Frame{rsvPing}, Expect: Expect{Codes: protocolError()}},
+		{ID: "13.3.2", Description: "Send a fragmented message with RSV1 set on the continuation frame.", Expectation: "The connection is failed immediately, since RSV1 is only allowed on the first frame.",
+			Extensions: offer, Frames: rsvCont, Expect: Expect{Codes: protocolError()}},
+		{ID: "13.3.3", Description: "Send a compressed text message with invalid UTF-8.", Expectation: "The connection is failed immediately, since the decompressed payload is not valid UTF-8.",
+			Extensions: offer, Frames: []Frame{compressed([]byte("\xce\xba\xe1\xbd\xb9\xcf\x83\xce\xbc\xce\xb5\xed\xa0\x80\x65\x64\x69\x74\x65\x64"))}, Expect: Expect{Codes: invalidData()}},
+	}
+}
@@ -0,0 +1,293 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package conformance
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/antlabs/wsutil/bytespool"
+	"github.com/antlabs/wsutil/closecode"
+	"github.com/antlabs/wsutil/deflate"
+	"github.com/antlabs/wsutil/enum"
+	"github.com/antlabs/wsutil/extension"
+	"github.com/antlabs/wsutil/fixedreader"
+	"github.com/antlabs/wsutil/frame"
+	"github.com/antlabs/wsutil/handshake"
+	"github.com/antlabs/wsutil/mask"
+	"github.com/antlabs/wsutil/opcode"
+)
+
+var ErrBadExtensionResponse = errors.New("conformance: server accepted permessage-deflate with parameters that were not offered")
+
+const extensionName = "permessage-deflate"
+
+// 测试客户端, 发送Case里面的frame, 记录收到的消息
+type client struct {
+	conn net.Conn
+	r    *fixedreader.FixedReader
+
+	// 协商了permessage-deflate
+	deflate bool
+	// 客户端压缩使用的窗口位数
+	clientBits uint8
+	// 上下文接管时才有值, nil的时候每个消息单独压缩/解压
+	en *deflate.CompressContextTakeover
+	de *deflate.DeCompressContextTakeover
+}
+
+// 读协程的结果
+type readResult struct {
+	events   []Event
+	code     closecode.StatusCode
+	gotClose bool
+	err      error
+}
+
+func (c *client) handshake(u *url.URL, extensions string) error {
+	key := handshake.GenSecWebSocketKey()
+	header := http.Header{}
+	var names []string
+	if extensions != "" {
+		header.Set("Sec-WebSocket-Extensions", extensions)
+		for _, o := range extension.Parse(header) {
+			names = append(names, o.Name)
+		}
+	}
+
+	if _, err := c.conn.Write(handshake.AppendRequest(nil, u, key, header)); err != nil {
+		return err
+	}
+
+	c.r = fixedreader.NewFixedReader(c.conn, bytespool.GetBytes(4096))
+	rsp, err := handshake.ReadResponse(c.r, key, nil, names)
+	if err != nil {
+		return err
+	}
+	if rsp.Extensions == "" {
+		return nil
+	}
+	return c.negotiate(header, rsp.Header)
+}
+
+// 检查服务端响应的permessage-deflate参数, 初始化压缩和解压缩
+// 响应至少要和客户端的一个offer匹配
+// https://datatracker.ietf.org/doc/html/rfc7692#section-7.1
+func (c *client) negotiate(request, response http.Header) error {
+	accepted := extension.Parse(response)
+	if len(accepted) != 1 || accepted[0].Name != extensionName {
+		return ErrBadExtensionResponse
+	}
+
+	var params map[string]string
+	for _, offer := range extension.Parse(request) {
+		if offer.Name != extensionName {
+			continue
+		}
+		if p, ok := matchOffer(offer.Params, accepted[0].Params); ok {
+			params = p
+			break
+		}
+	}
+	if params == nil {
+		return ErrBadExtensionResponse
+	}
+
+	c.deflate = true
+	c.clientBits = 15
+	if v, ok := params["client_max_window_bits"]; ok {
+		bits, _ := strconv.Atoi(v)
+		c.clientBits = uint8(bits)
+	}
+	if _, ok := params["client_no_context_takeover"]; !ok {
+		c.en, _ = deflate.NewCompressContextTakeover(c.clientBits)
+	}
+
+	serverBits := uint8(15)
+	if v, ok := params["server_max_window_bits"]; ok {
+		bits, _ := strconv.Atoi(v)
+		serverBits = uint8(bits)
+	}
+	if _, ok := params["server_no_context_takeover"]; !ok {
+		c.de, _ = deflate.NewDecompressContextTakeover(serverBits)
+	}
+	return nil
+}
+
+// 响应的参数是不是offer允许的, 返回响应的参数
+func matchOffer(offer, response []extension.Param) (map[string]string, bool) {
+	offered := make(map[string]string, len(offer))
+	for _, p := range offer {
+		offered[p.Name] = p.Value
+	}
+
+	params := make(map[string]string, len(response))
+	for _, p := range response {
+		if _, ok := params[p.Name]; ok {
+			return nil, false
+		}
+		params[p.Name] = p.Value
+
+		switch p.Name {
+		case "server_no_context_takeover", "client_no_context_takeover":
+			if p.Value != "" {
+				return nil, false
+			}
+		case "server_max_window_bits", "client_max_window_bits":
+			bits, err := strconv.Atoi(p.Value)
+			if err != nil || bits < 8 || bits > 15 {
+				return nil, false
+			}
+
+			// 客户端没有提供client_max_window_bits, 服务端不能使用
+			v, ok := offered[p.Name]
+			if !ok && p.Name == "client_max_window_bits" {
+				return nil, false
+			}
+			// 服务端只能降低客户端要求的窗口
+			if max, err := strconv.Atoi(v); ok && err == nil && bits > max {
+				return nil, false
+			}
+		default:
+			return nil, false
+		}
+	}
+
+	// 客户端要求服务端不使用上下文, 服务端必须同意
+	if _, ok := offered["server_no_context_takeover"]; ok {
+		if _, ok := params["server_no_context_takeover"]; !ok {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// 写出一个frame, 按照f的要求压缩, 分片和分多次写
+func (c *client) writeFrame(f *Frame) error {
+	payload := f.Payload
+	rsv1 := f.Rsv1
+	if f.Compress && c.deflate {
+		out, err := c.en.Compress(&payload, c.clientBits)
+		if err != nil {
+			return err
+		}
+		payload = *out
+		rsv1 = true
+	}
+
+	n := f.Split
+	if n < 1 {
+		n = 1
+	}
+
+	var buf []byte
+	for i := 0; i < n; i++ {
+		part := payload[len(payload)*i/n : len(payload)*(i+1)/n]
+		op, r1 := f.Opcode, rsv1
+		if i > 0 {
+			op, r1 = opcode.Continuation, false
+		}
+
+		var head [enum.MaxFrameHeaderSize]byte
+		key := mask.NewKey()
+		have, err := frame.WriteHeader(head[:], f.Fin && i == n-1, r1, f.Rsv2, f.Rsv3, op, len(part), true, key)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, head[:have]...)
+		start := len(buf)
+		buf = append(buf, part...)
+		mask.Mask(buf[start:], key)
+	}
+
+	if err := c.write(buf, f.Chop); err != nil {
+		return err
+	}
+	if f.Delay > 0 {
+		time.Sleep(f.Delay)
+	}
+	return nil
+}
+
+func (c *client) write(buf []byte, chop int) error {
+	if chop <= 0 {
+		chop = len(buf)
+	}
+	for len(buf) > 0 {
+		n := chop
+		if n > len(buf) {
+			n = len(buf)
+		}
+		if _, err := c.conn.Write(buf[:n]); err != nil {
+			return err
+		}
+		buf = buf[n:]
+	}
+	return nil
+}
+
+func (c *client) writeClose(code closecode.StatusCode) error {
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	return c.writeFrame(&Frame{Fin: true, Opcode: opcode.Close, Payload: payload})
+}
+
+// 读到close frame, 连接断开或者超时为止
+func (c *client) readLoop() (res readResult) {
+	v := frame.Validator{Rsv1: c.deflate}
+	a := frame.Assembler{MaxMessage: DefaultMaxMessage, CheckUTF8: true}
+	if c.deflate {
+		// nil的*DeCompressContextTakeover也可以解压, 不使用上下文
+		a.Decompressor = c.de
+	}
+	defer a.Reset()
+	defer func() { bytespool.PutBytes(c.r.BufPtr()) }()
+
+	var headArray [enum.MaxFrameHeaderSize]byte
+	for {
+		f, err := v.ReadFrameFromWindowsV2(c.r, &headArray, 1.0, DefaultMaxMessage)
+		if err != nil {
+			res.err = err
+			return res
+		}
+
+		m, ok, err := a.PushV2(f)
+		if err != nil {
+			res.err = fmt.Errorf("invalid frame from server: %w", err)
+			return res
+		}
+		if !ok {
+			continue
+		}
+
+		if m.Opcode == opcode.Close {
+			res.gotClose = true
+			res.code, _, err = closecode.Decode(*m.Payload)
+			if err != nil {
+				res.err = fmt.Errorf("invalid close frame from server: %w", err)
+			}
+			m.Free()
+			return res
+		}
+
+		res.events = append(res.events, Event{Opcode: m.Opcode, Payload: append([]byte{}, *m.Payload...)})
+		m.Free()
+	}
+}
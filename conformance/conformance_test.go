@@ -0,0 +1,85 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package conformance
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// 内置的EchoServer要通过所有的case
+func Test_Conformance(t *testing.T) {
+	report, err := Run(Cases(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, res := range report["wsutil"] {
+		if res.Behavior != OK || res.BehaviorClose != OK {
+			t.Errorf("%s: %s/%s: %s", id, res.Behavior, res.BehaviorClose, res.Result)
+		}
+	}
+}
+
+// 不接受permessage-deflate的服务端, 12.x会失败, 其他的不受影响
+func Test_Conformance_NoCompression(t *testing.T) {
+	report, err := Run(Filter(Cases(), []string{"1.1.*", "12.1.1", "13.1.1"}), Options{Agent: "plain", Server: &EchoServer{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := report["plain"]
+	if len(results) != 10 {
+		t.Fatalf("got %d results", len(results))
+	}
+	if res := results["12.1.1"]; res.Behavior != Failed {
+		t.Errorf("12.1.1: got %s, want FAILED", res.Behavior)
+	}
+	if res := results["13.1.1"]; !res.Passed() {
+		t.Errorf("13.1.1: %s", res.Result)
+	}
+	if failed := report.Failed(); len(failed) != 1 || failed[0] != "plain/12.1.1" {
+		t.Errorf("failed = %v", failed)
+	}
+}
+
+func Test_Report_JSON(t *testing.T) {
+	report, err := Run(Filter(Cases(), []string{"2.1", "2.5"}), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = report.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]map[string]map[string]interface{}
+	if err = json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, code := range map[string]float64{"2.1": 1000, "2.5": 1002} {
+		res := got["wsutil"][id]
+		for _, key := range []string{"description", "expectation", "behavior", "behaviorClose", "duration", "remoteCloseCode"} {
+			if _, ok := res[key]; !ok {
+				t.Errorf("%s: missing %s", id, key)
+			}
+		}
+		if res["behavior"] != "OK" || res["remoteCloseCode"] != code {
+			t.Errorf("%s: %v", id, res)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package conformance
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+
+	"github.com/antlabs/wsutil/closecode"
+)
+
+// 和Autobahn TestSuite报告里面的behavior一样
+type Behavior string
+
+const (
+	OK        Behavior = "OK"
+	NonStrict Behavior = "NON-STRICT"
+	Failed    Behavior = "FAILED"
+	// 只用在BehaviorClose, 对端没有发送close frame就断开了连接
+	Unclean Behavior = "UNCLEAN"
+	// 只用在BehaviorClose, close frame里面的状态码不对
+	WrongCode Behavior = "WRONG CODE"
+)
+
+// Result 一个case的结果, 字段和Autobahn的index.json一样
+type Result struct {
+	Description   string   `json:"description"`
+	Expectation   string   `json:"expectation"`
+	Behavior      Behavior `json:"behavior"`
+	BehaviorClose Behavior `json:"behaviorClose"`
+	// 单位毫秒
+	Duration int64 `json:"duration"`
+	// 对端close frame里面的状态码, 没有收到close frame时为0
+	RemoteCloseCode closecode.StatusCode `json:"remoteCloseCode"`
+	// 出错的原因
+	Result string `json:"result,omitempty"`
+}
+
+// 是否通过, NON-STRICT也算通过
+func (r *Result) Passed() bool {
+	return (r.Behavior == OK || r.Behavior == NonStrict) && r.BehaviorClose == OK
+}
+
+// Report agent -> case编号 -> 结果, 和Autobahn的reports/servers/index.json格式一样
+type Report map[string]map[string]Result
+
+// 没有通过的case编号, 格式是agent/编号
+func (r Report) Failed() (failed []string) {
+	for agent, results := range r {
+		for id, res := range results {
+			if !res.Passed() {
+				failed = append(failed, agent+"/"+id)
+			}
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
+
+// 写出缩进过的json
+func (r Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
@@ -0,0 +1,194 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package conformance
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/antlabs/wsutil/opcode"
+)
+
+// 每个case默认的超时时间
+const DefaultTimeout = 2 * time.Second
+
+// Options Run的参数
+type Options struct {
+	// 报告里面的名字, 默认是wsutil
+	Agent string
+	// 测试这个地址的服务端, 比如ws://127.0.0.1:9001/, 不支持wss
+	// 为空时在127.0.0.1上启动Server
+	URL string
+	// URL为空时使用, nil使用支持permessage-deflate的EchoServer
+	Server *EchoServer
+	// 每个case的超时时间, 0表示DefaultTimeout
+	Timeout time.Duration
+}
+
+// 按顺序运行cases, 返回Autobahn格式的报告
+func Run(cases []Case, opt Options) (Report, error) {
+	if opt.Agent == "" {
+		opt.Agent = "wsutil"
+	}
+	if opt.Timeout <= 0 {
+		opt.Timeout = DefaultTimeout
+	}
+
+	rawURL := opt.URL
+	if rawURL == "" {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		defer ln.Close()
+
+		srv := opt.Server
+		if srv == nil {
+			srv = &EchoServer{Compression: true}
+		}
+		go srv.Serve(ln)
+		rawURL = "ws://" + ln.Addr().String() + "/"
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]Result, len(cases))
+	for i := range cases {
+		results[cases[i].ID] = RunCase(u, &cases[i], opt.Timeout)
+	}
+	return Report{opt.Agent: results}, nil
+}
+
+// 运行一个case
+func RunCase(u *url.URL, tc *Case, timeout time.Duration) (res Result) {
+	start := time.Now()
+	res.Description = tc.Description
+	res.Expectation = tc.Expectation
+	defer func() { res.Duration = time.Since(start).Milliseconds() }()
+
+	conn, err := net.DialTimeout("tcp", u.Host, timeout)
+	if err != nil {
+		return failed(res, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(start.Add(timeout))
+
+	c := client{conn: conn}
+	if err = c.handshake(u, tc.Extensions); err != nil {
+		return failed(res, err)
+	}
+
+	switch {
+	case tc.Expect.NoExtension && c.deflate:
+		return failed(res, errors.New("server accepted an extension offer it must decline"))
+	case !tc.Expect.NoExtension && tc.Extensions != "" && !c.deflate:
+		return failed(res, errors.New("server declined the extension offer"))
+	}
+
+	done := make(chan readResult, 1)
+	go func() { done <- c.readLoop() }()
+
+	// 对端可能已经关闭了连接, 写出错之后不再写, 结果以读到的为准
+	sentClose := false
+	for i := range tc.Frames {
+		f := &tc.Frames[i]
+		if err = c.writeFrame(f); err != nil {
+			break
+		}
+		if f.Opcode == opcode.Close {
+			sentClose = true
+		}
+	}
+	if err == nil && !sentClose {
+		c.writeClose(1000)
+	}
+
+	r := <-done
+	return evaluate(res, &tc.Expect, &r)
+}
+
+func failed(res Result, err error) Result {
+	res.Behavior = Failed
+	res.BehaviorClose = Failed
+	res.Result = err.Error()
+	return res
+}
+
+func evaluate(res Result, expect *Expect, r *readResult) Result {
+	res.RemoteCloseCode = r.code
+
+	switch {
+	case !r.gotClose:
+		res.BehaviorClose = Unclean
+	case expect.codeOK(r.code):
+		res.BehaviorClose = OK
+	default:
+		res.BehaviorClose = WrongCode
+	}
+
+	var msgs []string
+	if r.err != nil && !isEOF(r.err) {
+		msgs = append(msgs, r.err.Error())
+	}
+	if !eventsEqual(r.events, expect.Events) {
+		msgs = append(msgs, fmt.Sprintf("got events %v, want %v", r.events, expect.Events))
+	}
+	if res.BehaviorClose == WrongCode {
+		msgs = append(msgs, fmt.Sprintf("got close code %d, want %v", r.code, expect.Codes))
+	}
+	if !r.gotClose {
+		msgs = append(msgs, "connection dropped without a close frame")
+	}
+	res.Result = strings.Join(msgs, "; ")
+
+	switch {
+	case len(msgs) == 0:
+		res.Behavior = OK
+	case !r.gotClose && expect.failing() && eventsEqual(r.events, expect.Events) && isEOF(r.err):
+		// 出错的时候直接断开了连接, 没有发送close frame
+		res.Behavior = NonStrict
+	default:
+		res.Behavior = Failed
+	}
+	return res
+}
+
+// 对端关闭了连接(包括RST), 超时不算
+func isEOF(err error) bool {
+	if err == nil || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var oe *net.OpError
+	return errors.As(err, &oe) && !oe.Timeout()
+}
+
+func eventsEqual(a, b []Event) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,233 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package conformance
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/antlabs/wsutil/bytespool"
+	"github.com/antlabs/wsutil/closecode"
+	"github.com/antlabs/wsutil/deflate"
+	"github.com/antlabs/wsutil/enum"
+	"github.com/antlabs/wsutil/extension"
+	"github.com/antlabs/wsutil/fixedreader"
+	"github.com/antlabs/wsutil/fixedwriter"
+	"github.com/antlabs/wsutil/frame"
+	"github.com/antlabs/wsutil/handshake"
+	"github.com/antlabs/wsutil/opcode"
+)
+
+// 默认的消息最大长度
+const DefaultMaxMessage = 16 * 1024 * 1024
+
+// EchoServer 只使用wsutil里面的函数实现的echo服务端, 收到什么消息就发回什么消息
+// 握手, frame检查, 分片组装, utf-8检查, close握手, permessage-deflate都在这里
+type EchoServer struct {
+	// 是否接受permessage-deflate
+	Compression bool
+	// 见deflate.Extension
+	ServerMaxWindowBits uint8
+	ClientMaxWindowBits uint8
+
+	// 消息的最大长度, 0表示DefaultMaxMessage
+	MaxMessage int64
+
+	// 发送close frame之后, 等待对端关闭连接的时间, 0表示2秒
+	CloseTimeout time.Duration
+}
+
+// 接受连接, 每个连接一个go程, ln关闭之后返回
+func (s *EchoServer) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// 处理一个连接, 返回的时候连接已经关闭
+func (s *EchoServer) ServeConn(conn net.Conn) error {
+	defer conn.Close()
+
+	br := bufio.NewReader(conn)
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return err
+	}
+
+	key, err := handshake.CheckRequest(req)
+	if err != nil {
+		io.WriteString(conn, "HTTP/1.1 400 Bad Request\r\nConnection: close\r\n\r\n")
+		return err
+	}
+
+	var ext *deflate.Extension
+	var response string
+	if s.Compression {
+		de := deflate.NewExtension()
+		de.ServerMaxWindowBits = s.ServerMaxWindowBits
+		de.ClientMaxWindowBits = s.ClientMaxWindowBits
+		var accepted []extension.Extension
+		if accepted, response = extension.Negotiate(req.Header, []extension.Extension{de}); len(accepted) > 0 {
+			ext = de
+			defer ext.Release()
+		}
+	}
+
+	if err = handshake.WriteResponse(conn, key, "", response); err != nil {
+		return err
+	}
+
+	c := serverConn{EchoServer: s, conn: conn, br: br, ext: ext}
+	return c.serve()
+}
+
+// 一个连接的状态
+type serverConn struct {
+	*EchoServer
+	conn net.Conn
+	// http.ReadRequest可能多读了数据, 后面都从br里面读
+	br  *bufio.Reader
+	ext *deflate.Extension
+	fw  fixedwriter.FixedWriter
+}
+
+// Assembler使用的解压缩接口
+type decodeFunc func(payload *[]byte, maxMessage int64) (*[]byte, error)
+
+func (f decodeFunc) Decompress(payload *[]byte, maxMessage int64) (*[]byte, error) {
+	return f(payload, maxMessage)
+}
+
+func (c *serverConn) serve() (err error) {
+	maxMessage := c.MaxMessage
+	if maxMessage <= 0 {
+		maxMessage = DefaultMaxMessage
+	}
+
+	v := frame.Validator{NeedMask: true, Rsv1: c.ext != nil}
+	a := frame.Assembler{MaxMessage: maxMessage, CheckUTF8: true}
+	if c.ext != nil {
+		a.Decompressor = decodeFunc(c.ext.Decode)
+	}
+	defer a.Reset()
+
+	buf := bytespool.GetBytes(1024 + enum.MaxFrameHeaderSize)
+	r := fixedreader.NewFixedReader(c.br, buf)
+	// 读大的frame时会换一块buf, 旧的已经放回池子里了
+	defer func() { bytespool.PutBytes(r.BufPtr()) }()
+
+	var headArray [enum.MaxFrameHeaderSize]byte
+	for {
+		f, err := v.ReadFrameFromWindowsV2(r, &headArray, 1.0, maxMessage)
+		if err != nil {
+			return c.fail(err)
+		}
+
+		m, ok, err := a.PushV2(f)
+		if err != nil {
+			return c.fail(err)
+		}
+		if !ok {
+			continue
+		}
+
+		err = c.handle(&m)
+		m.Free()
+		if err != nil {
+			if errors.Is(err, errClosed) {
+				return nil
+			}
+			return c.fail(err)
+		}
+	}
+}
+
+var errClosed = errors.New("conformance: close handshake finished")
+
+func (c *serverConn) handle(m *frame.Message) error {
+	switch m.Opcode {
+	case opcode.Ping:
+		return c.write(opcode.Pong, *m.Payload, false)
+	case opcode.Pong:
+		return nil
+	case opcode.Close:
+		code, _, err := closecode.Decode(*m.Payload)
+		if err != nil {
+			return err
+		}
+
+		// 对端没有带状态码, 回一个空的close frame
+		var payload []byte
+		if code != closecode.NoStatusReceived {
+			payload, _ = closecode.Encode(code, "")
+		}
+		if err = c.write(opcode.Close, payload, false); err != nil {
+			return err
+		}
+		c.drain()
+		return errClosed
+	}
+
+	if c.ext == nil {
+		return c.write(m.Opcode, *m.Payload, false)
+	}
+
+	out, rsv, err := c.ext.Encode(m.Payload)
+	if err != nil {
+		return err
+	}
+	err = c.write(m.Opcode, *out, rsv != 0)
+	if out != m.Payload {
+		bytespool.PutBytes(out)
+	}
+	return err
+}
+
+func (c *serverConn) write(op opcode.Opcode, payload []byte, rsv1 bool) error {
+	return frame.WriteFrame(&c.fw, c.conn, payload, true, rsv1, false, op, 0)
+}
+
+// 读写出错, 对端已经不在了直接返回, 其他的错误使用对应的状态码关闭连接
+func (c *serverConn) fail(err error) error {
+	var ne net.Error
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &ne) {
+		return err
+	}
+
+	payload, _ := closecode.Encode(closecode.FromError(err), "")
+	if werr := c.write(opcode.Close, payload, false); werr != nil {
+		return werr
+	}
+	c.drain()
+	return err
+}
+
+// 发送close frame之后, 丢掉对端的数据, 直到对端关闭连接
+// 直接关闭的话, 没有读的数据会让内核发送RST, 对端可能收不到close frame
+func (c *serverConn) drain() {
+	timeout := c.CloseTimeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	c.conn.SetReadDeadline(time.Now().Add(timeout))
+	io.Copy(io.Discard, c.br)
+}
@@ -49,7 +49,9 @@ var (
 func newCompressContextTakeover(w io.WriteCloser, level int, bit uint8) (*flate.Writer, *sync.Pool) {
 	var fw *flate.Writer
 	var p *sync.Pool
-	if bit > 0 {
+	// 15位就是32KB的窗口, 和level的压缩器一样, 这时候使用level
+	// 小于15位时, 只能使用自定义窗口的压缩器, level不生效
+	if bit > 0 && bit < 15 {
 
 		p = &flateWriterBitPools[bit-uint8(minBit)]
 
@@ -91,6 +93,16 @@ func NewCompressContextTakeover(bit uint8) (en *CompressContextTakeover, err err
 }
 
 func (e *CompressContextTakeover) Compress(payload *[]byte, bit uint8) (encodePayload *[]byte, err error) {
+	return e.compress(payload, DefaultCompressionLevel, bit)
+}
+
+// 同Compress, 可以指定压缩级别, level一般是Policy.CompressionLevel()
+func (e *CompressContextTakeover) CompressLevel(payload *[]byte, level int, bit uint8) (encodePayload *[]byte, err error) {
+	return e.compress(payload, level, bit)
+}
+
+// 同Compress, 可以指定压缩级别
+func (e *CompressContextTakeover) compress(payload *[]byte, level int, bit uint8) (encodePayload *[]byte, err error) {
 
 	encodeBuf := bytespool.GetBytes(len(*payload) + enum.MaxFrameHeaderSize)
 
@@ -98,7 +110,7 @@ func (e *CompressContextTakeover) Compress(payload *[]byte, bit uint8) (encodePa
 	if e != nil {
 		dict = e.dict.GetData()
 	}
-	w, p := newCompressContextTakeover(nil, DefaultCompressionLevel, bit)
+	w, p := newCompressContextTakeover(nil, level, bit)
 
 	defer func() {
 		// 如果没有出错
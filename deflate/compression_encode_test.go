@@ -14,6 +14,8 @@
 package deflate
 
 import (
+	"bytes"
+	"fmt"
 	"reflect"
 	"testing"
 
@@ -63,3 +65,70 @@ func TestEnCompressContextTakeover_Compress(t *testing.T) {
 		})
 	}
 }
+
+func Test_StatefulCompressor(t *testing.T) {
+	for _, bit := range []uint8{0, 9, 15} {
+		c := NewStatefulCompressor(DefaultCompressionLevel, bit)
+		d, _ := NewDecompressContextTakeover(15)
+		for i := 0; i < 20; i++ {
+			payload := []byte(fmt.Sprintf(`{"id":%d,"method":"subscribe","params":["btcusdt@trade"]}`, i%3))
+			encoded, err := c.Compress(&payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decoded, err := d.Decompress(encoded, 0)
+			if err != nil {
+				t.Fatalf("bit:%d, index:%d, %v", bit, i, err)
+			}
+
+			if !bytes.Equal(payload, *decoded) {
+				t.Fatalf("bit:%d, index:%d, got %s, want %s", bit, i, *decoded, payload)
+			}
+
+			// 中间释放掉flate.Writer, 对端还是可以解压
+			if i%7 == 6 {
+				c.Release()
+			}
+		}
+		c.Release()
+	}
+}
+
+var chattyMessages = func() (msgs [][]byte) {
+	for i := 0; i < 64; i++ {
+		msgs = append(msgs, []byte(fmt.Sprintf(`{"e":"trade","s":"BTCUSDT","t":%d,"p":"6712%d.10","q":"0.00%d","m":%v}`, 1000+i, i%10, i%7, i%2 == 0)))
+	}
+	return msgs
+}()
+
+func Benchmark_Compress_ContextTakeover(b *testing.B) {
+	e, _ := NewCompressContextTakeover(15)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		msg := chattyMessages[i%len(chattyMessages)]
+		out, err := e.Compress(&msg, 0)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(int64(len(msg)))
+		_ = out
+	}
+}
+
+func Benchmark_Compress_Stateful(b *testing.B) {
+	c := NewStatefulCompressor(DefaultCompressionLevel, 0)
+	defer c.Release()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		msg := chattyMessages[i%len(chattyMessages)]
+		out, err := c.Compress(&msg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(int64(len(msg)))
+		_ = out
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package deflate
+
+import (
+	"bytes"
+	"sync"
+	"unsafe"
+
+	"github.com/antlabs/wsutil/bytespool"
+	"github.com/antlabs/wsutil/enum"
+	"github.com/klauspost/compress/flate"
+)
+
+// flate.Writer的输出, 每个消息换一块内存
+type sliceWriter struct {
+	buf []byte
+}
+
+func (w *sliceWriter) Write(p []byte) (n int, err error) {
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+// StatefulCompressor 上下文接管的压缩, 一个连接一个对象, 不能并发使用
+//
+// 和CompressContextTakeover不一样, 整个连接使用同一个flate.Writer, 消息之间只调用Flush,
+// 窗口留在flate.Writer里面, 不用每个消息拷贝一次dict再重新计算hash
+//
+// 连接空闲的时候可以调用Release把flate.Writer放回池里面, 下个消息再拿一个新的
+// 新的flate.Writer没有之前的窗口, 压缩率会差一点, 但是对端的解压缩不受影响:
+// 压缩的一方本来就可以不引用之前的数据
+type StatefulCompressor struct {
+	level int
+	bit   uint8
+
+	fw  *flate.Writer
+	p   *sync.Pool
+	out sliceWriter
+}
+
+// 创建一个StatefulCompressor
+// bit为0时使用level, 不为0时使用2^bit的窗口(level不生效)
+func NewStatefulCompressor(level int, bit uint8) *StatefulCompressor {
+	if level < minCompressionLevel || level > maxCompressionLevel {
+		level = DefaultCompressionLevel
+	}
+	return &StatefulCompressor{level: level, bit: bit}
+}
+
+// 压缩一个消息, 返回的内存来自bytespool, 用完可以调用bytespool.PutBytes
+func (c *StatefulCompressor) Compress(payload *[]byte) (encodePayload *[]byte, err error) {
+	if c.fw == nil {
+		c.fw, c.p = newCompressContextTakeover(nil, c.level, c.bit)
+		// 池里面的flate.Writer可能是CompressContextTakeover用过的, Reset会重新加载它记住的dict,
+		// 那是别的连接的数据, 这里必须使用ResetDict清掉
+		c.fw.ResetDict(&c.out, nil)
+	}
+
+	encodeBuf := bytespool.GetBytes(len(*payload) + enum.MaxFrameHeaderSize)
+	c.out.buf = (*encodeBuf)[:0]
+	defer func() {
+		c.out.buf = nil
+	}()
+
+	if _, err = c.fw.Write(*payload); err != nil {
+		c.drop()
+		return nil, err
+	}
+
+	if err = c.fw.Flush(); err != nil {
+		c.drop()
+		return nil, err
+	}
+
+	out := c.out.buf
+	if len(out) >= 4 {
+		if !bytes.Equal(out[len(out)-4:], enTail) {
+			c.drop()
+			return nil, ErrUnexpectedFlateStream
+		}
+		out = out[:len(out)-4]
+	}
+
+	if unsafe.SliceData(*encodeBuf) != unsafe.SliceData(out) {
+		bytespool.PutBytes(encodeBuf)
+	}
+	return &out, nil
+}
+
+// 把flate.Writer放回池里面, 连接空闲或者关闭的时候调用
+func (c *StatefulCompressor) Release() {
+	if c.fw == nil {
+		return
+	}
+	// 不要让池里面的对象引用这个连接的内存
+	c.fw.ResetDict(nil, nil)
+	c.p.Put(c.fw)
+	c.fw, c.p = nil, nil
+}
+
+// 出错之后flate.Writer的状态不确定, 不放回池里面
+func (c *StatefulCompressor) drop() {
+	c.fw, c.p = nil, nil
+}
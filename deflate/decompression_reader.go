@@ -0,0 +1,100 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package deflate
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/antlabs/wsutil/limitreader"
+	"github.com/klauspost/compress/flate"
+)
+
+var ErrReaderClosed = errors.New("decompress reader closed")
+
+// DecompressReader 流式解压一个消息
+//
+// 和DeCompressContextTakeover.Decompress不一样, 不需要把整个压缩的payload收完,
+// 也不用把整个解压之后的数据放到一块内存里面
+// src是这个消息所有frame的payload连起来(不包括0x00 0x00 0xff 0xff), 消息结束的时候src返回io.EOF,
+// src读完之后才会加上0x00 0x00 0xff 0xff
+//
+// 上下文接管的时候, 必须读到io.EOF, 不然窗口是不完整的, 后面的消息没法解压
+type DecompressReader struct {
+	d   *DeCompressContextTakeover
+	fr  io.Reader
+	r   io.Reader
+	err error
+}
+
+// 创建一个流式解压的reader, d为nil时表示上下文不接管
+// maxMessage是解压之后的最大长度, 0表示不限制, 超过之后Read返回limitreader.ErrTooBigMessage
+func (d *DeCompressContextTakeover) NewReader(src io.Reader, maxMessage int64) *DecompressReader {
+	var dict []byte
+	if d != nil {
+		dict = d.dict.GetData()
+	}
+
+	fr, _ := flateReaderPool.Get().(io.Reader)
+	frt, ok := fr.(flate.Resetter)
+	if !ok {
+		panic("not found flate.Resetter")
+	}
+	frt.Reset(io.MultiReader(src, bytes.NewReader(tailBytes)), dict)
+
+	dr := &DecompressReader{d: d, fr: fr, r: fr}
+	if maxMessage > 0 {
+		dr.r = limitreader.NewLimitReader(fr, maxMessage)
+	}
+	return dr
+}
+
+// 实现io.Reader接口, 边读边更新上下文接管的窗口
+func (dr *DecompressReader) Read(p []byte) (n int, err error) {
+	if dr.err != nil {
+		return 0, dr.err
+	}
+
+	n, err = dr.r.Read(p)
+	if n > 0 && dr.d != nil {
+		dr.d.dict.Write(p[:n])
+	}
+
+	if err != nil {
+		dr.err = err
+		if err == io.EOF {
+			dr.release()
+		}
+	}
+	return n, err
+}
+
+// 把解码器放回池里面, 出错的解码器不会放回去
+// 读到io.EOF之后会自动放回去, 没有读完也可以调用
+func (dr *DecompressReader) Close() error {
+	if dr.err == nil {
+		dr.err = ErrReaderClosed
+		dr.release()
+	}
+	dr.fr = nil
+	return nil
+}
+
+func (dr *DecompressReader) release() {
+	if dr.fr != nil {
+		flateReaderPool.Put(dr.fr)
+		dr.fr = nil
+	}
+}
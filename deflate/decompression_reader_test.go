@@ -0,0 +1,102 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package deflate
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/antlabs/wsutil/limitreader"
+)
+
+// 把压缩之后的payload切成多个frame, 一个一个frame给reader
+func splitFrames(payload []byte, size int) io.Reader {
+	var frames []io.Reader
+	for len(payload) > size {
+		frames = append(frames, bytes.NewReader(payload[:size]))
+		payload = payload[size:]
+	}
+	frames = append(frames, bytes.NewReader(payload))
+	return iotest.HalfReader(io.MultiReader(frames...))
+}
+
+func Test_DecompressReader(t *testing.T) {
+	t.Run("context.takeover", func(t *testing.T) {
+		en := NewStatefulCompressor(DefaultCompressionLevel, 0)
+		defer en.Release()
+		de, _ := NewDecompressContextTakeover(15)
+
+		for i := 0; i < 5; i++ {
+			msg := []byte(strings.Repeat("hello wsutil ", 1000+i))
+			encoded, err := en.Compress(&msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := de.NewReader(splitFrames(*encoded, 7), 0)
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("index:%d, %v", i, err)
+			}
+			r.Close()
+			if !bytes.Equal(got, msg) {
+				t.Fatalf("index:%d, decoded data mismatch", i)
+			}
+		}
+	})
+
+	t.Run("no.context.takeover", func(t *testing.T) {
+		msg := []byte(strings.Repeat("a", 64*1024))
+		var en *CompressContextTakeover
+		encoded, err := en.Compress(&msg, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var de *DeCompressContextTakeover
+		got, err := io.ReadAll(de.NewReader(splitFrames(*encoded, 3), 0))
+		if err != nil || !bytes.Equal(got, msg) {
+			t.Fatalf("err:%v, len:%d", err, len(got))
+		}
+	})
+
+	t.Run("max.message", func(t *testing.T) {
+		msg := []byte(strings.Repeat("a", 64*1024))
+		var en *CompressContextTakeover
+		encoded, _ := en.Compress(&msg, 0)
+
+		var de *DeCompressContextTakeover
+		r := de.NewReader(bytes.NewReader(*encoded), 1024)
+		n, err := io.Copy(io.Discard, r)
+		if err != limitreader.ErrTooBigMessage {
+			t.Fatalf("got %v, want %v", err, limitreader.ErrTooBigMessage)
+		}
+		if n > 1024 {
+			t.Fatalf("read %d bytes before the limit", n)
+		}
+		r.Close()
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		var de *DeCompressContextTakeover
+		r := de.NewReader(bytes.NewReader(nil), 0)
+		r.Close()
+		if _, err := r.Read(make([]byte, 1)); err != ErrReaderClosed {
+			t.Fatalf("got %v, want %v", err, ErrReaderClosed)
+		}
+	})
+}
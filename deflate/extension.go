@@ -0,0 +1,160 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package deflate
+
+import (
+	"github.com/antlabs/wsutil/extension"
+)
+
+const extensionName = "permessage-deflate"
+
+// Extension permessage-deflate的extension.Extension实现, 服务端使用, 一个连接一个对象
+// 协商之后, Encode压缩发给客户端的消息, Decode解压客户端的消息
+// https://datatracker.ietf.org/doc/html/rfc7692
+type Extension struct {
+	// 压缩策略, 压缩级别只有服务端的窗口是15位时才生效
+	Policy Policy
+
+	// 服务端压缩使用的最大窗口位数, 8-15, 0表示15
+	// 客户端的offer带了server_max_window_bits时, 使用两个里面小的那个
+	ServerMaxWindowBits uint8
+
+	// 允许客户端压缩使用的最大窗口位数, 8-15, 0表示15, 决定了解压缩需要的内存
+	// 只有客户端的offer带了client_max_window_bits时才能生效, 不然客户端会使用15位
+	ClientMaxWindowBits uint8
+
+	// 协商的结果
+	Conf PermessageDeflateConf
+
+	// 上下文接管的时候才有值, 为nil时每个消息单独压缩/解压
+	en *StatefulCompressor
+	de *DeCompressContextTakeover
+
+	state policyState
+}
+
+var _ extension.Extension = (*Extension)(nil)
+
+func NewExtension() *Extension {
+	return &Extension{Policy: DefaultPolicy}
+}
+
+func (e *Extension) Name() string {
+	return extensionName
+}
+
+// permessage-deflate使用RSV1
+func (e *Extension) Rsv() byte {
+	return extension.Rsv1
+}
+
+// 检查客户端的一个offer, 可以接受就初始化压缩和解压缩的上下文
+func (e *Extension) Negotiate(params []extension.Param) (response []extension.Param, ok bool) {
+	conf, err := parseOffer(params)
+	if err != nil {
+		return nil, false
+	}
+
+	// 服务端可以降低窗口, 不能提高
+	// https://datatracker.ietf.org/doc/html/rfc7692#section-7.1.2
+	conf.ServerMaxWindowBits = agreeWindowBits(conf.ServerMaxWindowBits, e.ServerMaxWindowBits, true)
+	conf.ClientMaxWindowBits = agreeWindowBits(conf.ClientMaxWindowBits, e.ClientMaxWindowBits, false)
+
+	e.Conf = conf
+	e.Release()
+	e.en, e.de = nil, nil
+	if conf.ServerContextTakeover {
+		e.en = NewStatefulCompressor(e.Policy.CompressionLevel(), conf.ServerMaxWindowBits)
+	}
+
+	if conf.ClientContextTakeover {
+		if e.de, err = NewDecompressContextTakeover(windowBits(conf.ClientMaxWindowBits)); err != nil {
+			return nil, false
+		}
+	}
+	return conf.params(), true
+}
+
+// 按照Policy压缩一个消息, 压缩了返回的rsv是extension.Rsv1, 没有压缩原样返回payload
+func (e *Extension) Encode(payload *[]byte) (out *[]byte, rsv byte, err error) {
+	if !e.state.shouldCompress(&e.Policy, len(*payload)) {
+		return payload, 0, nil
+	}
+
+	if e.en == nil {
+		var en *CompressContextTakeover
+		out, err = en.compress(payload, e.Policy.CompressionLevel(), e.Conf.ServerMaxWindowBits)
+	} else {
+		out, err = e.en.Compress(payload)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if !e.state.observe(&e.Policy, len(*payload), len(*out)) {
+		// 后面不会再压缩了, 对端的上下文只和压缩过的消息有关, 不受影响
+		e.Release()
+	}
+	return out, extension.Rsv1, nil
+}
+
+// 这个连接的压缩统计
+func (e *Extension) Stats() *Stats {
+	return &e.state.Stats
+}
+
+// 连接空闲或者关闭的时候调用, 把压缩用的flate.Writer放回池里面
+func (e *Extension) Release() {
+	if e.en != nil {
+		e.en.Release()
+	}
+}
+
+// 解压一个消息
+func (e *Extension) Decode(payload *[]byte, maxMessage int64) (*[]byte, error) {
+	return e.de.Decompress(payload, maxMessage)
+}
+
+// 协商一个方向的窗口位数, offered是客户端offer里面的值, 0表示没有这个参数
+// local是本地的限制, 0表示15
+// canAdd为true时, 客户端没有带这个参数, 服务端也可以在响应里面加上(server_max_window_bits)
+// 返回0表示响应里面不带这个参数, 使用15位
+func agreeWindowBits(offered, local uint8, canAdd bool) uint8 {
+	switch {
+	case local == 0 || local > 15:
+		local = 15
+	case local < 8:
+		local = 8
+	}
+
+	if offered == 0 {
+		if canAdd && local < 15 {
+			return local
+		}
+		return 0
+	}
+
+	if local < offered {
+		return local
+	}
+	return offered
+}
+
+// 没有协商窗口大小时, 使用最大的窗口
+func windowBits(bits uint8) uint8 {
+	if bits == 0 {
+		return 15
+	}
+	return bits
+}
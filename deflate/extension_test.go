@@ -0,0 +1,245 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package deflate
+
+import (
+	"bytes"
+	stdflate "compress/flate"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/antlabs/wsutil/extension"
+	"github.com/klauspost/compress/flate"
+)
+
+func Test_Extension_Negotiate(t *testing.T) {
+	tests := []struct {
+		name     string
+		offer    string
+		ok       bool
+		response string
+	}{
+		{name: "plain", offer: "permessage-deflate", ok: true, response: "permessage-deflate; client_no_context_takeover; server_no_context_takeover"},
+		{name: "unknown.extension", offer: "x-webkit-deflate-frame, permessage-deflate; client_no_context_takeover", ok: true, response: "permessage-deflate; client_no_context_takeover; server_no_context_takeover"},
+		{
+			name:     "second.offer",
+			offer:    "permessage-deflate; foo, permessage-deflate; client_max_window_bits=16, permessage-deflate; client_max_window_bits",
+			ok:       true,
+			response: "permessage-deflate; server_no_context_takeover; client_max_window_bits=15",
+		},
+		{name: "duplicate.param", offer: "permessage-deflate; server_no_context_takeover; server_no_context_takeover"},
+		{name: "param.with.value", offer: "permessage-deflate; client_no_context_takeover=1"},
+		{name: "none", offer: "x-webkit-deflate-frame"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewExtension()
+			h := http.Header{"Sec-Websocket-Extensions": {tt.offer}}
+			accepted, response := extension.Negotiate(h, []extension.Extension{e})
+			if (len(accepted) == 1) != tt.ok || response != tt.response {
+				t.Fatalf("Negotiate() = %v, %q, want %v, %q", accepted, response, tt.ok, tt.response)
+			}
+
+			// 和GetConnPermessageDeflate的结果一样
+			pd, err := GetConnPermessageDeflate(h)
+			if (err == nil) != tt.ok {
+				t.Fatalf("GetConnPermessageDeflate() error = %v", err)
+			}
+			if err == nil && GenSecWebSocketExtensions(pd) != response {
+				t.Fatalf("GenSecWebSocketExtensions() = %s, want %s", GenSecWebSocketExtensions(pd), response)
+			}
+		})
+	}
+}
+
+func Test_Extension_EncodeDecode(t *testing.T) {
+	server := NewExtension()
+	client := NewExtension()
+	// 双方都使用上下文接管
+	h := http.Header{"Sec-Websocket-Extensions": {"permessage-deflate; client_max_window_bits; server_max_window_bits=15"}}
+	for _, e := range []*Extension{server, client} {
+		if accepted, _ := extension.Negotiate(h, []extension.Extension{e}); len(accepted) != 1 {
+			t.Fatal("negotiate failed")
+		}
+	}
+
+	msg := bytes.Repeat([]byte("hello world "), 100)
+	first := 0
+	for i := 0; i < 3; i++ {
+		payload := append([]byte(nil), msg...)
+		encoded, _, err := server.Encode(&payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			first = len(*encoded)
+		} else if len(*encoded) >= first {
+			// 有上下文, 后面的消息只是对前面消息的引用
+			t.Fatalf("context takeover not used, encoded size %d, first %d", len(*encoded), first)
+		}
+
+		// 两边都有解压的上下文, 这里只是验证数据
+		decoded, err := client.Decode(encoded, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(*decoded, msg) {
+			t.Fatalf("round %d: decoded data mismatch", i)
+		}
+	}
+}
+
+func Test_Extension_WindowBits(t *testing.T) {
+	tests := []struct {
+		name       string
+		offer      string
+		serverBits uint8
+		clientBits uint8
+		response   string
+	}{
+		{
+			name:     "offer.only",
+			offer:    "permessage-deflate; client_max_window_bits=10; server_max_window_bits=11",
+			response: "permessage-deflate; client_max_window_bits=10; server_max_window_bits=11",
+		},
+		{
+			name:       "server.lowers",
+			offer:      "permessage-deflate; client_max_window_bits; server_max_window_bits=12",
+			serverBits: 10,
+			clientBits: 9,
+			response:   "permessage-deflate; client_max_window_bits=9; server_max_window_bits=10",
+		},
+		{
+			name:       "server.can.not.raise",
+			offer:      "permessage-deflate; client_max_window_bits=9; server_max_window_bits=9",
+			serverBits: 12,
+			clientBits: 12,
+			response:   "permessage-deflate; client_max_window_bits=9; server_max_window_bits=9",
+		},
+		{
+			// 客户端没有带client_max_window_bits, 服务端不能限制客户端
+			name:       "client.not.offered",
+			offer:      "permessage-deflate",
+			serverBits: 10,
+			clientBits: 9,
+			response:   "permessage-deflate; client_no_context_takeover; server_no_context_takeover; server_max_window_bits=10",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewExtension()
+			e.ServerMaxWindowBits = tt.serverBits
+			e.ClientMaxWindowBits = tt.clientBits
+			h := http.Header{"Sec-Websocket-Extensions": {tt.offer}}
+			if _, response := extension.Negotiate(h, []extension.Extension{e}); response != tt.response {
+				t.Fatalf("got %s, want %s", response, tt.response)
+			}
+		})
+	}
+}
+
+// 对端的解压缩只有2^9字节的窗口: 每个消息使用一个新的解码器, 历史数据只有最后512字节
+// 使用标准库的flate, 和这个包的实现没有关系
+type peerDecoder struct {
+	history []byte
+}
+
+func (p *peerDecoder) decode(payload []byte) ([]byte, error) {
+	fr := stdflate.NewReaderDict(io.MultiReader(bytes.NewReader(payload), bytes.NewReader(tailBytes)), p.history)
+	out, err := io.ReadAll(fr)
+	if err != nil {
+		return nil, err
+	}
+	p.history = append(p.history, out...)
+	if len(p.history) > 1<<9 {
+		p.history = append([]byte(nil), p.history[len(p.history)-1<<9:]...)
+	}
+	return out, nil
+}
+
+// 生成有重复的消息, 重复的距离有近有远, 超过2^9的引用对端是解不出来的
+func windowTestMessages() (msgs [][]byte) {
+	words := []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel"}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		var b bytes.Buffer
+		for j := r.Intn(2000); j >= 0; j-- {
+			b.WriteString(words[r.Intn(len(words))])
+			b.WriteString(strconv.Itoa(r.Intn(100)))
+		}
+		msgs = append(msgs, b.Bytes())
+	}
+	return msgs
+}
+
+func Test_Extension_WindowBits9_Interop(t *testing.T) {
+	h := http.Header{"Sec-Websocket-Extensions": {"permessage-deflate; client_max_window_bits=9; server_max_window_bits=9"}}
+	e := NewExtension()
+	if accepted, _ := extension.Negotiate(h, []extension.Extension{e}); len(accepted) != 1 {
+		t.Fatal("negotiate failed")
+	}
+	defer e.Release()
+
+	if !e.Conf.ServerContextTakeover || !e.Conf.ClientContextTakeover {
+		t.Fatalf("want context takeover, got %#v", e.Conf)
+	}
+
+	t.Run("server.to.peer", func(t *testing.T) {
+		var peer peerDecoder
+		for i, msg := range windowTestMessages() {
+			payload := append([]byte(nil), msg...)
+			encoded, _, err := e.Encode(&payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := peer.decode(*encoded)
+			if err != nil {
+				t.Fatalf("index:%d, %v", i, err)
+			}
+			if !bytes.Equal(got, msg) {
+				t.Fatalf("index:%d, decoded data mismatch", i)
+			}
+		}
+	})
+
+	t.Run("peer.to.server", func(t *testing.T) {
+		// 对端的压缩只使用2^9字节的窗口
+		var out bytes.Buffer
+		fw, err := flate.NewWriterWindow(&out, 1<<9)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, msg := range windowTestMessages() {
+			out.Reset()
+			fw.Write(msg)
+			fw.Flush()
+			encoded := bytes.TrimSuffix(out.Bytes(), enTail)
+
+			got, err := e.Decode(&encoded, 0)
+			if err != nil {
+				t.Fatalf("index:%d, %v", i, err)
+			}
+			if !bytes.Equal(*got, msg) {
+				t.Fatalf("index:%d, decoded data mismatch", i)
+			}
+		}
+	})
+}
@@ -0,0 +1,200 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package deflate
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/antlabs/wsutil/extension"
+)
+
+// testdata/1.txt做种子
+// testdata/fuzz下面capture_开头的语料是gorilla/websocket, coder/websocket, gws和node的WebSocket在本机互相连接抓的包,
+// 包括协商的Sec-WebSocket-Extensions和压缩过的payload, synthetic_开头的是手工构造的, 和抓包内容一样的只保留synthetic_的那份
+// 重新抓包生成capture_语料: cd testdata/capture && go run .
+func readSeed(f *testing.F) []byte {
+	all, err := os.ReadFile("../testdata/1.txt")
+	if err != nil {
+		f.Fatal(err)
+	}
+	return all
+}
+
+// FuzzHistoryDictWrite的数据最长256字节, 窗口16到128字节
+// historyDict的逻辑和窗口大小无关, 数据长了新语料最小化的时候很慢(要试的次数是长度的平方), fuzz几乎停住
+const maxFuzzHistoryData = 256
+
+// 分块写入, 结果总是最近写入的len(data)个字节
+func FuzzHistoryDictWrite(f *testing.F) {
+	all := readSeed(f)
+	f.Add(all[:maxFuzzHistoryData], uint8(0), uint8(100))
+	f.Add(all[:200], uint8(3), uint8(1))
+	f.Add([]byte("hello"), uint8(0), uint8(0))
+
+	f.Fuzz(func(t *testing.T, data []byte, bit uint8, chunk uint8) {
+		if len(data) > maxFuzzHistoryData {
+			return
+		}
+		size := 1 << (bit%4 + 4)
+		var w historyDict
+		w.InitHistoryDict(size)
+
+		step := int(chunk)%(2*size) + 1
+		for i := 0; i < len(data); i += step {
+			end := i + step
+			if end > len(data) {
+				end = len(data)
+			}
+			w.Write(data[i:end])
+		}
+
+		want := data
+		if len(want) > size {
+			want = want[len(want)-size:]
+		}
+		if !bytes.Equal(w.GetData(), want) {
+			t.Fatalf("size = %d, step = %d, got %d bytes, want %d bytes", size, step, len(w.GetData()), len(want))
+		}
+	})
+}
+
+// 任意的Sec-WebSocket-Extensions不能panic, 协商出来的窗口位数要合法
+func FuzzParseExtensions(f *testing.F) {
+	f.Add("permessage-deflate; client_max_window_bits")
+	f.Add("permessage-deflate; server_max_window_bits=10; client_max_window_bits=\"9\", permessage-deflate")
+	f.Add("x-webkit-deflate-frame, permessage-deflate; client_no_context_takeover; server_no_context_takeover")
+
+	f.Fuzz(func(t *testing.T, value string) {
+		header := http.Header{"Sec-Websocket-Extensions": {value}}
+		offers := extension.Parse(header)
+		list := make([]string, 0, len(offers))
+		for _, o := range offers {
+			if o.Name == "" {
+				t.Fatalf("empty name: %q", value)
+			}
+			list = append(list, o.String())
+		}
+
+		// Offer.String()生成的值可以解析回同样的offers
+		again := extension.Parse(http.Header{"Sec-Websocket-Extensions": {strings.Join(list, ", ")}})
+		if !reflect.DeepEqual(offers, again) {
+			t.Fatalf("%q: %v != %v", value, offers, again)
+		}
+
+		pmd, err := parsePermessageDeflate(header)
+		if err != nil {
+			return
+		}
+		for _, bits := range []uint8{pmd.ClientMaxWindowBits, pmd.ServerMaxWindowBits} {
+			if bits != 0 && (bits < 8 || bits > 15) {
+				t.Fatalf("bits = %d: %q", bits, value)
+			}
+		}
+
+		// 生成的响应可以再解析回来
+		header.Set("Sec-Websocket-Extensions", GenSecWebSocketExtensions(pmd))
+		if _, err := parsePermessageDeflate(header); err != nil {
+			t.Fatalf("%q -> %q: %v", value, header.Get("Sec-Websocket-Extensions"), err)
+		}
+	})
+}
+
+// 任意的压缩数据不能panic, 解压后的大小不能超过maxMessage
+func FuzzDecompress(f *testing.F) {
+	all := readSeed(f)
+	var en *CompressContextTakeover
+	out, err := en.Compress(&all, 0)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(*out)
+	f.Add([]byte{0xf2, 0x48, 0xcd, 0xc9, 0xc9, 0x07, 0x00}) // "Hello"
+	f.Add([]byte{0x00, 0x00, 0xff, 0xff})
+
+	const maxMessage = 1 << 20
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		var de *DeCompressContextTakeover
+		if out, err := de.Decompress(&payload, maxMessage); err == nil && len(*out) > maxMessage {
+			t.Fatalf("len(out) = %d", len(*out))
+		}
+
+		// 上下文接管, 解压第二次的时候会用到第一次的dict
+		de, _ = NewDecompressContextTakeover(15)
+		for i := 0; i < 2; i++ {
+			if _, err := de.Decompress(&payload, maxMessage); err != nil {
+				return
+			}
+		}
+	})
+}
+
+// 压缩之后再解压, 得到原来的数据
+// 不接管上下文, 接管上下文, StatefulCompressor三种都要测试
+func FuzzCompressDecompress(f *testing.F) {
+	all := readSeed(f)
+	f.Add(all, []byte("hello"), uint8(0))
+	f.Add(all[:1000], all[500:], uint8(9))
+	f.Add([]byte{}, []byte{0}, uint8(15))
+
+	f.Fuzz(func(t *testing.T, msg1, msg2 []byte, bit uint8) {
+		bit = bit%8 + 8
+		msgs := [][]byte{msg1, msg2, msg1}
+
+		check := func(name string, i int, de *DeCompressContextTakeover, out *[]byte) {
+			got, err := de.Decompress(out, 0)
+			if err != nil {
+				t.Fatalf("%s: message %d: %v", name, i, err)
+			}
+			if !bytes.Equal(*got, msgs[i]) {
+				t.Fatalf("%s: message %d mismatch", name, i)
+			}
+		}
+
+		for i, msg := range msgs {
+			var en *CompressContextTakeover
+			var de *DeCompressContextTakeover
+			out, err := en.Compress(&msg, bit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			check("no context", i, de, out)
+		}
+
+		en, _ := NewCompressContextTakeover(bit)
+		de, _ := NewDecompressContextTakeover(bit)
+		for i, msg := range msgs {
+			out, err := en.Compress(&msg, bit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			check("context", i, de, out)
+		}
+
+		sc := NewStatefulCompressor(DefaultCompressionLevel, bit)
+		defer sc.Release()
+		de, _ = NewDecompressContextTakeover(bit)
+		for i, msg := range msgs {
+			out, err := sc.Compress(&msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			check("stateful", i, de, out)
+		}
+	})
+}
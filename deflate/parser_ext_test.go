@@ -17,27 +17,34 @@ import (
 	"net/http"
 	"reflect"
 	"testing"
+
+	"github.com/antlabs/wsutil/extension"
 )
 
-func Test_parseExtensions(t *testing.T) {
+func Test_ParseExtensions(t *testing.T) {
 	type args struct {
 		header http.Header
 	}
 	tests := []struct {
 		name string
 		args args
-		want []pair
+		want []extension.Offer
 	}{
 		{
-			name: "Test_parseExtensions",
+			name: "permessage-deflate",
 			args: args{header: http.Header{"Sec-Websocket-Extensions": {"permessage-deflate; client_max_window_bits=15; server_max_window_bits=15; client_no_context_takeover; server_no_context_takeover"}}},
-			want: []pair{{key: "permessage-deflate", val: ""}, {key: "client_max_window_bits", val: "15"}, {key: "server_max_window_bits", val: "15"}, {key: "client_no_context_takeover", val: ""}, {key: "server_no_context_takeover", val: ""}},
+			want: []extension.Offer{{Name: "permessage-deflate", Params: []extension.Param{{Name: "client_max_window_bits", Value: "15"}, {Name: "server_max_window_bits", Value: "15"}, {Name: "client_no_context_takeover"}, {Name: "server_no_context_takeover"}}}},
+		},
+		{
+			name: "multi.offer",
+			args: args{header: http.Header{"Sec-Websocket-Extensions": {"permessage-deflate; client_max_window_bits, permessage-deflate"}}},
+			want: []extension.Offer{{Name: "permessage-deflate", Params: []extension.Param{{Name: "client_max_window_bits"}}}, {Name: "permessage-deflate"}},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := parseExtensions(tt.args.header); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("parseExtensions() = %v, want %v", got, tt.want)
+			if got := extension.Parse(tt.args.header); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extension.Parse() = %v, want %v", got, tt.want)
 			}
 		})
 	}
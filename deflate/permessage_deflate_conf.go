@@ -16,7 +16,8 @@ package deflate
 import (
 	"net/http"
 	"strconv"
-	"strings"
+
+	"github.com/antlabs/wsutil/extension"
 )
 
 // https://datatracker.ietf.org/doc/html/rfc7692#section-7.1
@@ -62,53 +63,64 @@ func parseMaxWindowBits(val string) (uint8, error) {
 	return uint8(bits), nil
 }
 
-// 解析Sec-Websocket-Extensions的值
-func parsePermessageDeflate(header http.Header) (pmd PermessageDeflateConf, err error) {
-	params := parseExtensions(header)
-	pd := false
+// 解析permessage-deflate的一个offer
+// 不认识的参数, 重复的参数, 不合法的值, 都返回http.ErrNotSupported, 这个offer不能接受
+// https://datatracker.ietf.org/doc/html/rfc7692#section-5.1
+func parseOffer(params []extension.Param) (pmd PermessageDeflateConf, err error) {
+	var seen [4]bool
 	clientNoContext := false
 	serverNoContext := false
+	clientMaxWindowBits := false
+	serverMaxWindowBits := false
 
 	for _, param := range params {
-		switch param.key {
-		case "permessage-deflate":
-			pd = true
+		var i int
+		switch param.Name {
 		case "server_no_context_takeover":
-			if pd {
-				pmd.ServerContextTakeover = false
-				pmd.Enable = true
-				pmd.Decompression = true
-				serverNoContext = true
-			}
+			i, serverNoContext = 0, true
 		case "client_no_context_takeover":
-			if pd {
-				pmd.ClientContextTakeover = false
-				pmd.Enable = true
-				pmd.Compression = true
-				clientNoContext = true
-			}
+			i, clientNoContext = 1, true
 		case "client_max_window_bits":
-			if pmd.ClientMaxWindowBits, err = parseMaxWindowBits(param.val); err != nil {
-				return
-			}
-
-			if !clientNoContext {
-				pmd.ClientContextTakeover = true
+			if pmd.ClientMaxWindowBits, err = parseMaxWindowBits(param.Value); err != nil {
+				return pmd, http.ErrNotSupported
 			}
+			i, clientMaxWindowBits = 2, true
 		case "server_max_window_bits":
-			if pmd.ServerMaxWindowBits, err = parseMaxWindowBits(param.val); err != nil {
-				return
-			}
-
-			if !serverNoContext {
-				pmd.ServerContextTakeover = true
+			if pmd.ServerMaxWindowBits, err = parseMaxWindowBits(param.Value); err != nil {
+				return pmd, http.ErrNotSupported
 			}
+			i, serverMaxWindowBits = 3, true
 		default:
-			err = http.ErrNotSupported
-			return
+			return pmd, http.ErrNotSupported
+		}
+
+		if seen[i] || i < 2 && param.Value != "" {
+			return pmd, http.ErrNotSupported
+		}
+		seen[i] = true
+	}
+
+	pmd.Enable = true
+	pmd.Decompression = true
+	pmd.Compression = true
+	pmd.ServerContextTakeover = serverMaxWindowBits && !serverNoContext
+	pmd.ClientContextTakeover = clientMaxWindowBits && !clientNoContext
+	return pmd, nil
+}
+
+// 解析Sec-Websocket-Extensions的值
+// 返回第一个可以接受的permessage-deflate offer, 其他扩展会被忽略
+func parsePermessageDeflate(header http.Header) (pmd PermessageDeflateConf, err error) {
+	for _, offer := range extension.Parse(header) {
+		if offer.Name != extensionName {
+			continue
+		}
+
+		if pmd, err = parseOffer(offer.Params); err == nil {
+			return pmd, nil
 		}
 	}
-	return
+	return PermessageDeflateConf{}, http.ErrNotSupported
 }
 
 // 是否打开解压缩
@@ -116,23 +128,27 @@ func GetConnPermessageDeflate(header http.Header) (pd PermessageDeflateConf, err
 	return parsePermessageDeflate(header)
 }
 
-func GenSecWebSocketExtensions(pd PermessageDeflateConf) string {
-	ext := make([]string, 1, 5)
-	ext[0] = "permessage-deflate"
+// 响应里面的参数
+func (pd *PermessageDeflateConf) params() []extension.Param {
+	params := make([]extension.Param, 0, 4)
 	if !pd.ClientContextTakeover {
-		ext = append(ext, "client_no_context_takeover")
+		params = append(params, extension.Param{Name: "client_no_context_takeover"})
 	}
 
 	if !pd.ServerContextTakeover {
-		ext = append(ext, "server_no_context_takeover")
+		params = append(params, extension.Param{Name: "server_no_context_takeover"})
 	}
 
 	if pd.ClientMaxWindowBits != 0 {
-		ext = append(ext, "client_max_window_bits="+strconv.Itoa(int(pd.ClientMaxWindowBits)))
+		params = append(params, extension.Param{Name: "client_max_window_bits", Value: strconv.Itoa(int(pd.ClientMaxWindowBits))})
 	}
 
 	if pd.ServerMaxWindowBits != 0 {
-		ext = append(ext, "server_max_window_bits="+strconv.Itoa(int(pd.ServerMaxWindowBits)))
+		params = append(params, extension.Param{Name: "server_max_window_bits", Value: strconv.Itoa(int(pd.ServerMaxWindowBits))})
 	}
-	return strings.Join(ext, "; ")
+	return params
+}
+
+func GenSecWebSocketExtensions(pd PermessageDeflateConf) string {
+	return extension.Offer{Name: extensionName, Params: pd.params()}.String()
 }
@@ -20,9 +20,11 @@ type historyDict struct {
 	ringthPos int
 }
 
-func (w *historyDict) InitHistoryDict(ringthPos int) {
-	w.data = make([]byte, ringthPos)
-	w.ringthPos = ringthPos
+// size是窗口的大小, 刚开始没有历史数据
+// 不能把size个0当成历史数据, 对端的压缩/解压缩没有这些0, 引用了就会出错
+func (w *historyDict) InitHistoryDict(size int) {
+	w.data = make([]byte, size)
+	w.ringthPos = 0
 }
 
 func (w *historyDict) Write(data []byte) {
@@ -0,0 +1,114 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package deflate
+
+import (
+	"sync/atomic"
+)
+
+// 自适应模式默认连续观察的消息数
+const defaultAdaptiveSamples = 8
+
+// Policy 压缩策略, 决定一个消息要不要压缩, 以及使用的压缩级别
+type Policy struct {
+	// flate的压缩级别, -2到9, 0表示DefaultCompressionLevel
+	// 窗口小于15位时不生效, 见NewStatefulCompressor
+	Level int
+
+	// 小于MinSize的消息不压缩, 直接发送(RSV1为0)
+	// 太小的消息压缩之后可能更大, 还浪费cpu
+	MinSize int
+
+	// 自适应模式, 压缩之后的大小/压缩之前的大小 大于MaxRatio的消息是压缩效果差的
+	// 连续AdaptiveSamples个消息效果都差, 这个连接后面的消息就不再压缩
+	// 0表示不开启
+	MaxRatio float64
+
+	// 0表示defaultAdaptiveSamples
+	AdaptiveSamples int
+}
+
+// 默认的策略, 和之前的行为一样, 所有消息都使用DefaultCompressionLevel压缩
+var DefaultPolicy = Policy{Level: DefaultCompressionLevel}
+
+// 实际使用的压缩级别, Level是0或者不合法时使用DefaultCompressionLevel
+func (p *Policy) CompressionLevel() int {
+	if p.Level == 0 || p.Level < minCompressionLevel || p.Level > maxCompressionLevel {
+		return DefaultCompressionLevel
+	}
+	return p.Level
+}
+
+// Stats 一个连接的压缩统计, 可以在别的go程里面读取
+type Stats struct {
+	// 所有消息压缩之前的字节数, 包括没有压缩的
+	BytesIn atomic.Uint64
+	// 所有消息实际发送的字节数, 没有压缩的按原来的大小算
+	BytesOut atomic.Uint64
+	// 压缩过的消息数
+	Compressed atomic.Uint64
+	// 没有压缩的消息数, 包括小于MinSize的和自适应关闭之后的
+	Skipped atomic.Uint64
+	// 没有压缩的消息的字节数, BytesIn减去它就是压缩过的消息压缩之前的字节数
+	SkippedBytes atomic.Uint64
+	// 自适应模式是否已经关闭了压缩
+	Disabled atomic.Bool
+}
+
+// 一个连接的策略状态
+type policyState struct {
+	Stats
+	// 连续压缩效果差的消息数
+	bad int
+}
+
+// 这个消息要不要压缩
+func (s *policyState) shouldCompress(p *Policy, n int) bool {
+	if n < p.MinSize || s.Disabled.Load() {
+		s.Skipped.Add(1)
+		s.SkippedBytes.Add(uint64(n))
+		s.BytesIn.Add(uint64(n))
+		s.BytesOut.Add(uint64(n))
+		return false
+	}
+	return true
+}
+
+// 记录一个压缩过的消息, 返回false表示自适应模式关闭了压缩
+func (s *policyState) observe(p *Policy, in, out int) bool {
+	s.BytesIn.Add(uint64(in))
+	s.BytesOut.Add(uint64(out))
+	s.Compressed.Add(1)
+
+	if p.MaxRatio <= 0 || in == 0 {
+		return true
+	}
+
+	if float64(out)/float64(in) <= p.MaxRatio {
+		s.bad = 0
+		return true
+	}
+
+	s.bad++
+	samples := p.AdaptiveSamples
+	if samples <= 0 {
+		samples = defaultAdaptiveSamples
+	}
+	if s.bad < samples {
+		return true
+	}
+
+	s.Disabled.Store(true)
+	return false
+}
@@ -0,0 +1,122 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package deflate
+
+import (
+	"bytes"
+	"math/rand"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/antlabs/wsutil/extension"
+)
+
+func newPolicyExtension(t *testing.T, p Policy) (*Extension, *DeCompressContextTakeover) {
+	e := NewExtension()
+	e.Policy = p
+	h := http.Header{"Sec-Websocket-Extensions": {"permessage-deflate; client_max_window_bits; server_max_window_bits=15"}}
+	if accepted, _ := extension.Negotiate(h, []extension.Extension{e}); len(accepted) != 1 {
+		t.Fatal("negotiate failed")
+	}
+	// 对端的解压缩
+	de, _ := NewDecompressContextTakeover(15)
+	return e, de
+}
+
+func Test_Policy(t *testing.T) {
+	text := []byte(strings.Repeat("hello policy ", 100))
+	// 每次都是不一样的随机数据, 上下文接管也压缩不了
+	r := rand.New(rand.NewSource(1))
+	random := func() []byte {
+		b := make([]byte, 1024)
+		r.Read(b)
+		return b
+	}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		msgs   [][]byte
+		// 每个消息是否压缩
+		want []bool
+		// 最后是否关闭了压缩
+		disabled bool
+	}{
+		{name: "default", policy: DefaultPolicy, msgs: [][]byte{text, []byte("a"), random()}, want: []bool{true, true, true}},
+		{name: "level.9", policy: Policy{Level: 9}, msgs: [][]byte{text, text}, want: []bool{true, true}},
+		{name: "invalid.level", policy: Policy{Level: 100}, msgs: [][]byte{text}, want: []bool{true}},
+		{name: "min.size", policy: Policy{MinSize: 64}, msgs: [][]byte{text, []byte("a"), text}, want: []bool{true, false, true}},
+		{
+			name:     "adaptive.disabled",
+			policy:   Policy{MaxRatio: 0.9, AdaptiveSamples: 2},
+			msgs:     [][]byte{random(), text, random(), random(), text},
+			want:     []bool{true, true, true, true, false},
+			disabled: true,
+		},
+		{
+			name:   "adaptive.compressible",
+			policy: Policy{MaxRatio: 0.9, AdaptiveSamples: 2},
+			msgs:   [][]byte{random(), text, random(), text, random()},
+			want:   []bool{true, true, true, true, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, de := newPolicyExtension(t, tt.policy)
+			defer e.Release()
+
+			var in, out, skipped, skippedBytes uint64
+			for i, msg := range tt.msgs {
+				payload := append([]byte(nil), msg...)
+				encoded, rsv, err := e.Encode(&payload)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if compressed := rsv == extension.Rsv1; compressed != tt.want[i] {
+					t.Fatalf("index:%d, compressed = %v, want %v", i, compressed, tt.want[i])
+				}
+
+				in += uint64(len(msg))
+				out += uint64(len(*encoded))
+				if rsv == 0 {
+					skipped++
+					skippedBytes += uint64(len(msg))
+					if !bytes.Equal(*encoded, msg) {
+						t.Fatalf("index:%d, uncompressed payload changed", i)
+					}
+					continue
+				}
+
+				// 跳过的消息不影响上下文接管
+				decoded, err := de.Decompress(encoded, 0)
+				if err != nil {
+					t.Fatalf("index:%d, %v", i, err)
+				}
+				if !bytes.Equal(*decoded, msg) {
+					t.Fatalf("index:%d, decoded data mismatch", i)
+				}
+			}
+
+			s := e.Stats()
+			if s.BytesIn.Load() != in || s.BytesOut.Load() != out || s.Skipped.Load() != skipped || s.SkippedBytes.Load() != skippedBytes ||
+				s.Compressed.Load() != uint64(len(tt.msgs))-skipped || s.Disabled.Load() != tt.disabled {
+				t.Fatalf("stats: in:%d out:%d compressed:%d skipped:%d skipped.bytes:%d disabled:%v",
+					s.BytesIn.Load(), s.BytesOut.Load(), s.Compressed.Load(), s.Skipped.Load(), s.SkippedBytes.Load(), s.Disabled.Load())
+			}
+		})
+	}
+}
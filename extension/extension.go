@@ -0,0 +1,194 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package extension
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/antlabs/wsutil/httptoken"
+)
+
+// RSV位, 和frame header第一个字节里面的位置一样
+const (
+	Rsv1 byte = 1 << 6
+	Rsv2 byte = 1 << 5
+	Rsv3 byte = 1 << 4
+)
+
+// 扩展的参数, 比如 client_max_window_bits=10
+// 没有值的参数Value为空
+type Param struct {
+	Name  string
+	Value string
+}
+
+// 客户端的一个offer, 或者服务端响应里面的一个扩展
+// 同一个扩展可以有多个offer, 参数不一样, 比如
+// Sec-WebSocket-Extensions: permessage-deflate; client_max_window_bits, permessage-deflate
+type Offer struct {
+	Name   string
+	Params []Param
+}
+
+// 生成header里面的值, 比如 permessage-deflate; client_max_window_bits=10
+func (o Offer) String() string {
+	return string(o.Append(nil))
+}
+
+// 同String, 结果追加到dst后面
+func (o Offer) Append(dst []byte) []byte {
+	dst = append(dst, o.Name...)
+	for _, p := range o.Params {
+		dst = append(dst, "; "...)
+		dst = append(dst, p.Name...)
+		if p.Value == "" {
+			continue
+		}
+
+		dst = append(dst, '=')
+		if httptoken.IsToken(p.Value) {
+			dst = append(dst, p.Value...)
+			continue
+		}
+		dst = append(dst, '"')
+		for i := 0; i < len(p.Value); i++ {
+			if b := p.Value[i]; b == '"' || b == '\\' {
+				dst = append(dst, '\\')
+			}
+			dst = append(dst, p.Value[i])
+		}
+		dst = append(dst, '"')
+	}
+	return dst
+}
+
+// 解析Sec-WebSocket-Extensions, 每个offer单独返回, 顺序和header里面的一样
+// 格式错误的header值, 从出错的位置开始忽略
+// https://datatracker.ietf.org/doc/html/rfc6455#section-9.1
+func Parse(header http.Header) (offers []Offer) {
+	// From RFC 6455:
+	//
+	//  Sec-WebSocket-Extensions = extension-list
+	//  extension-list = 1#extension
+	//  extension = extension-token *( ";" extension-param )
+	//  extension-token = registered-token
+	//  registered-token = token
+	//  extension-param = token [ "=" (token | quoted-string) ]
+headers:
+	for _, s := range header["Sec-Websocket-Extensions"] {
+		for {
+			var t string
+			t, s = httptoken.NextToken(httptoken.SkipSpace(s))
+			if t == "" {
+				continue headers
+			}
+
+			offer := Offer{Name: t}
+			for {
+				s = httptoken.SkipSpace(s)
+				if !strings.HasPrefix(s, ";") {
+					break
+				}
+				var k string
+				k, s = httptoken.NextToken(httptoken.SkipSpace(s[1:]))
+				if k == "" {
+					continue headers
+				}
+				s = httptoken.SkipSpace(s)
+				var v string
+				if strings.HasPrefix(s, "=") {
+					v, s = httptoken.NextTokenOrQuoted(httptoken.SkipSpace(s[1:]))
+					s = httptoken.SkipSpace(s)
+				}
+				if s != "" && s[0] != ',' && s[0] != ';' {
+					continue headers
+				}
+				offer.Params = append(offer.Params, Param{Name: k, Value: v})
+			}
+
+			if s != "" && s[0] != ',' {
+				continue headers
+			}
+			offers = append(offers, offer)
+			if s == "" {
+				continue headers
+			}
+			s = s[1:]
+		}
+	}
+	return offers
+}
+
+// Extension websocket扩展, 一个连接一个对象
+// https://datatracker.ietf.org/doc/html/rfc6455#section-9
+type Extension interface {
+	// 扩展名, 比如permessage-deflate
+	Name() string
+
+	// 使用的RSV位, Rsv1 Rsv2 Rsv3的组合
+	Rsv() byte
+
+	// 服务端检查客户端的一个offer
+	// 可以接受就返回响应里面的参数, 并且按照协商的结果初始化自己, 不能接受返回ok为false
+	Negotiate(params []Param) (response []Param, ok bool)
+
+	// 发送一个消息之前调用, 返回处理之后的payload, 以及这个消息需要设置的RSV位
+	// 扩展可以决定某个消息不处理, 这时候原样返回payload, rsv为0
+	Encode(payload *[]byte) (out *[]byte, rsv byte, err error)
+
+	// 收到一个完整的消息之后调用, maxMessage是处理之后的payload的最大长度, 0表示不限制
+	Decode(payload *[]byte, maxMessage int64) (*[]byte, error)
+}
+
+// 服务端协商扩展
+// 按客户端offer的顺序, 每个扩展选择第一个可以接受的offer, 不认识的扩展直接忽略
+// 两个扩展使用相同的RSV位时, 后面的不会被接受
+// 返回接受的扩展(顺序和响应里面的一样)和Sec-WebSocket-Extensions响应头的值
+func Negotiate(header http.Header, exts []Extension) (accepted []Extension, response string) {
+	var rsv byte
+	var buf []byte
+	done := make([]bool, len(exts))
+	for _, offer := range Parse(header) {
+		for i, ext := range exts {
+			if done[i] || ext.Name() != offer.Name || rsv&ext.Rsv() != 0 {
+				continue
+			}
+
+			params, ok := ext.Negotiate(offer.Params)
+			if !ok {
+				continue
+			}
+
+			done[i] = true
+			rsv |= ext.Rsv()
+			accepted = append(accepted, ext)
+			if len(buf) > 0 {
+				buf = append(buf, ", "...)
+			}
+			buf = Offer{Name: offer.Name, Params: params}.Append(buf)
+			break
+		}
+	}
+	return accepted, string(buf)
+}
+
+// 协商之后使用的RSV位, 一般用于设置frame.Validator
+func RsvBits(exts []Extension) (rsv1, rsv2, rsv3 bool) {
+	var rsv byte
+	for _, ext := range exts {
+		rsv |= ext.Rsv()
+	}
+	return rsv&Rsv1 != 0, rsv&Rsv2 != 0, rsv&Rsv3 != 0
+}
@@ -0,0 +1,132 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package extension
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func Test_Parse(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []Offer
+	}{
+		{name: "empty", values: nil, want: nil},
+		{
+			name:   "two.offers",
+			values: []string{"permessage-deflate; client_max_window_bits, permessage-deflate"},
+			want: []Offer{
+				{Name: "permessage-deflate", Params: []Param{{Name: "client_max_window_bits"}}},
+				{Name: "permessage-deflate"},
+			},
+		},
+		{
+			name:   "multi.header",
+			values: []string{"foo; a=1; b=\"x y\"", "permessage-deflate; server_max_window_bits=10"},
+			want: []Offer{
+				{Name: "foo", Params: []Param{{Name: "a", Value: "1"}, {Name: "b", Value: "x y"}}},
+				{Name: "permessage-deflate", Params: []Param{{Name: "server_max_window_bits", Value: "10"}}},
+			},
+		},
+		{
+			name:   "malformed",
+			values: []string{"foo, bar; =1, baz", "qux"},
+			want:   []Offer{{Name: "foo"}, {Name: "qux"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Parse(http.Header{"Sec-Websocket-Extensions": tt.values})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Parse() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Offer_String(t *testing.T) {
+	o := Offer{Name: "foo", Params: []Param{{Name: "a"}, {Name: "b", Value: "10"}, {Name: "c", Value: `x "y"`}}}
+	s := o.String()
+	if s != `foo; a; b=10; c="x \"y\""` {
+		t.Fatalf("got %s", s)
+	}
+
+	got := Parse(http.Header{"Sec-Websocket-Extensions": {s}})
+	if !reflect.DeepEqual(got, []Offer{o}) {
+		t.Fatalf("Parse(%s) = %#v", s, got)
+	}
+}
+
+type testExtension struct {
+	name   string
+	rsv    byte
+	accept string // 只接受带这个参数的offer
+	params []Param
+}
+
+func (e *testExtension) Name() string { return e.name }
+func (e *testExtension) Rsv() byte    { return e.rsv }
+
+func (e *testExtension) Negotiate(params []Param) ([]Param, bool) {
+	for _, p := range params {
+		if p.Name == e.accept {
+			e.params = params
+			return []Param{p}, true
+		}
+	}
+	return nil, false
+}
+
+func (e *testExtension) Encode(payload *[]byte) (*[]byte, byte, error) { return payload, e.rsv, nil }
+
+func (e *testExtension) Decode(payload *[]byte, maxMessage int64) (*[]byte, error) {
+	return payload, nil
+}
+
+func Test_Negotiate(t *testing.T) {
+	foo := &testExtension{name: "foo", rsv: Rsv1, accept: "ok"}
+	bar := &testExtension{name: "bar", rsv: Rsv1, accept: "ok"}
+	baz := &testExtension{name: "baz", rsv: Rsv2, accept: "ok"}
+
+	h := http.Header{"Sec-Websocket-Extensions": {"unknown; ok, foo; bad, foo; ok=1, foo; ok=2, bar; ok, baz; ok"}}
+	accepted, response := Negotiate(h, []Extension{foo, bar, baz})
+
+	// bar和foo都使用RSV1, 不能同时接受
+	if !reflect.DeepEqual(accepted, []Extension{foo, baz}) {
+		t.Fatalf("accepted = %v", accepted)
+	}
+
+	if response != "foo; ok=1, baz; ok" {
+		t.Fatalf("response = %s", response)
+	}
+
+	// 选中的是第一个可以接受的offer
+	if foo.params[0].Value != "1" {
+		t.Fatalf("foo params = %v", foo.params)
+	}
+
+	rsv1, rsv2, rsv3 := RsvBits(accepted)
+	if !rsv1 || !rsv2 || rsv3 {
+		t.Fatalf("rsv = %v %v %v", rsv1, rsv2, rsv3)
+	}
+
+	accepted, response = Negotiate(http.Header{}, []Extension{foo})
+	if len(accepted) != 0 || response != "" {
+		t.Fatalf("no offer, got %v %q", accepted, response)
+	}
+}
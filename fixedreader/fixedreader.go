@@ -14,20 +14,44 @@
 package fixedreader
 
 import (
+	"bytes"
 	"errors"
 	"io"
+
+	"github.com/antlabs/wsutil/bytespool"
+)
+
+var (
+	errNegativeRead = errors.New("fixedreader: reader returned negative count from Read")
+
+	// 要读的长度比整个缓存区还大
+	ErrBufferTooSmall = errors.New("fixedreader: buffer is too small")
+	// ReadSlice把缓存区读满了也没有找到分隔符
+	ErrBufferFull = errors.New("fixedreader: buffer full")
+	// Peek和Discard传入了负数
+	ErrNegativeCount = errors.New("fixedreader: negative count")
+	// 环形模式不支持的方法, 比如ReadN
+	ErrRingMode = errors.New("fixedreader: not supported in ring mode")
 )
 
-var errNegativeRead = errors.New("fixedreader: reader returned negative count from Read")
+// 连续多少次读到0字节, 就返回io.ErrNoProgress, 和bufio一样
+const maxConsecutiveEmptyReads = 100
 
 // 固定大小的FixedReader, 所有的内存都是提前分配好的
 // 标准库的bufio.Reader不能自定义buf传过去, 导致控制力度会差点
+//
+// 默认是线性模式, 数据在buf[R:W], 尾部写满了用LeftMove把数据挪到前面
+// 环形模式(NewRingReader)下R和W是一直增长的偏移, 下标是R%len(buf), 不会再挪数据,
+// 环形模式下只能使用Read/Peek/Discard/ReadByte/ReadSlice/WriteTo, 不要直接访问buf[R:W]
 type FixedReader struct {
 	buf    *[]byte
 	rd     io.Reader // reader provided by the client
 	R, W   int       // buf read and write positions
 	err    error
 	isInit bool
+	ring   bool
+	// 环形模式下, 绕回开头的数据拷贝到这里再返回
+	wrap *[]byte
 }
 
 func (b *FixedReader) Init(r io.Reader, buf *[]byte) {
@@ -36,10 +60,21 @@ func (b *FixedReader) Init(r io.Reader, buf *[]byte) {
 	b.isInit = true
 }
 
+// 同Init, 使用环形模式
+func (b *FixedReader) InitRing(r io.Reader, buf *[]byte) {
+	b.Init(r, buf)
+	b.ring = true
+}
+
 func (b *FixedReader) IsInit() bool {
 	return b.isInit
 }
 
+// 是否是环形模式
+func (b *FixedReader) IsRing() bool {
+	return b.ring
+}
+
 // newBuffer returns a new Buffer whose buffer has the specified size.
 func NewFixedReader(r io.Reader, buf *[]byte) *FixedReader {
 	fr := &FixedReader{}
@@ -47,10 +82,21 @@ func NewFixedReader(r io.Reader, buf *[]byte) *FixedReader {
 	return fr
 }
 
+// 环形模式的FixedReader, 读走的空间直接复用, 不需要LeftMove
+func NewRingReader(r io.Reader, buf *[]byte) *FixedReader {
+	fr := &FixedReader{}
+	fr.InitRing(r, buf)
+	return fr
+}
+
 func (b *FixedReader) Release() error {
 	if b.buf != nil {
 		b.buf = nil
 	}
+	if b.wrap != nil {
+		bytespool.PutBytes(b.wrap)
+		b.wrap = nil
+	}
 	return nil
 }
 
@@ -62,13 +108,15 @@ func (b *FixedReader) readErr() error {
 
 // 将缓存区重置为一个新的buf
 func (b *FixedReader) Reset(buf *[]byte) {
-	if len(*buf) < len((*b.buf)[b.R:b.W]) {
+	if len(*buf) < b.Buffered() {
 		panic("new buf size is too small")
 	}
 
-	copy(*buf, (*b.buf)[b.R:b.W])
-	b.W -= b.R
+	first, second := b.segments()
+	n := copy(*buf, first)
+	n += copy((*buf)[n:], second)
 	b.R = 0
+	b.W = n
 	b.buf = buf
 }
 
@@ -85,19 +133,22 @@ func (b *FixedReader) Bytes() []byte {
 	return *b.buf
 }
 
-// 返回剩余可写的缓存区大小
+// 返回剩余可写的缓存区大小, 只在线性模式下使用
 func (b *FixedReader) WriteCap() int {
 	return len((*b.buf)[b.W:])
 }
 
 // 返回剩余可用的缓存区大小
 func (b *FixedReader) Available() int64 {
+	if b.ring {
+		return int64(len(*b.buf) - b.Buffered())
+	}
 	return int64(len((*b.buf)[b.W:]) + b.R)
 }
 
-// 左移缓存区
+// 左移缓存区, 环形模式下不需要
 func (b *FixedReader) LeftMove() {
-	if b.R == 0 {
+	if b.R == 0 || b.ring {
 		return
 	}
 	// b.CountMove++
@@ -107,11 +158,12 @@ func (b *FixedReader) LeftMove() {
 	b.R = 0
 }
 
-// 返回可写的缓存区
+// 返回可写的缓存区, 只在线性模式下使用
 func (b *FixedReader) WriteCapBytes() []byte {
 	return (*b.buf)[b.W:]
 }
 
+// 只在线性模式下使用
 func (b *FixedReader) CloneAvailable() *FixedReader {
 	buf := (*b.buf)[b.W:]
 	return &FixedReader{rd: b.rd, buf: &buf}
@@ -119,14 +171,96 @@ func (b *FixedReader) CloneAvailable() *FixedReader {
 
 func (b *FixedReader) Buffered() int { return b.W - b.R }
 
+// 已经缓存的数据, 环形模式下绕回开头的部分在second里面
+func (b *FixedReader) segments() (first, second []byte) {
+	if !b.ring {
+		return (*b.buf)[b.R:b.W], nil
+	}
+
+	if b.R == b.W {
+		return nil, nil
+	}
+
+	l := len(*b.buf)
+	r, w := b.R%l, b.W%l
+	if r < w {
+		return (*b.buf)[r:w], nil
+	}
+	return (*b.buf)[r:], (*b.buf)[:w]
+}
+
+// 返回前n个缓存的数据, n <= b.Buffered()
+// 数据是连续的时候直接指向buf, 绕回开头了才拷贝一次
+func (b *FixedReader) peek(n int) []byte {
+	first, second := b.segments()
+	if len(first) >= n {
+		return first[:n]
+	}
+
+	if b.wrap == nil || len(*b.wrap) < n {
+		if b.wrap != nil {
+			bytespool.PutBytes(b.wrap)
+		}
+		b.wrap = bytespool.GetBytes(n)
+	}
+	copy(*b.wrap, first)
+	copy((*b.wrap)[len(first):n], second)
+	return (*b.wrap)[:n]
+}
+
+// 从rd读一次数据到空闲的缓存区
+// 线性模式下尾部写满了会先左移
+func (b *FixedReader) fill() {
+	if b.R == b.W {
+		b.R = 0
+		b.W = 0
+	}
+
+	var free []byte
+	if b.ring {
+		l := len(*b.buf)
+		start := b.W % l
+		end := start + l - b.Buffered()
+		if end > l {
+			end = l
+		}
+		free = (*b.buf)[start:end]
+	} else {
+		if b.W == len(*b.buf) {
+			b.LeftMove()
+		}
+		free = (*b.buf)[b.W:]
+	}
+
+	if len(free) == 0 {
+		return
+	}
+
+	for i := maxConsecutiveEmptyReads; i > 0; i-- {
+		n, err := b.rd.Read(free)
+		if n < 0 {
+			panic(errNegativeRead)
+		}
+		b.W += n
+		if err != nil {
+			b.err = err
+			return
+		}
+		if n > 0 {
+			return
+		}
+	}
+	b.err = io.ErrNoProgress
+}
+
 // 这和一般read接口中不一样
-// 传入的p 一定会满足这个大小
+// 传入的p 一定会满足这个大小, p比整个缓存区还大时返回ErrBufferTooSmall
 func (b *FixedReader) Read(p []byte) (n int, err error) {
-	if cap(*b.buf) < cap(p) {
-		panic("fixedReader.Reader buf size is too small: cap(b.buf) < cap(p)")
+	n = len(p)
+	if n > len(*b.buf) {
+		return 0, ErrBufferTooSmall
 	}
 
-	n = len(p)
 	if n == 0 {
 		if b.Buffered() > 0 {
 			return 0, nil
@@ -134,38 +268,31 @@ func (b *FixedReader) Read(p []byte) (n int, err error) {
 		return 0, b.readErr()
 	}
 
-	var n1 int
-	for {
-
-		if b.R == b.W || len((*b.buf)[b.R:b.W]) < len(p) {
-			if b.err != nil {
-				return 0, b.readErr()
-			}
-			if b.R == b.W {
-				b.R = 0
-				b.W = 0
-			}
-			n1, b.err = b.rd.Read((*b.buf)[b.W:])
-			if n1 < 0 {
-				panic(errNegativeRead)
-			}
-			if n1 == 0 {
-				return 0, b.readErr()
-			}
-			b.W += n1
-			continue
+	for b.Buffered() < n {
+		if b.err != nil {
+			return 0, b.readErr()
 		}
-
-		n1 = copy(p, (*b.buf)[b.R:b.W])
-		b.R += n1
-
-		return n, nil
+		if !b.ring && b.R+n > len(*b.buf) {
+			b.LeftMove()
+		}
+		b.fill()
 	}
+
+	first, second := b.segments()
+	n1 := copy(p, first)
+	copy(p[n1:], second)
+	b.R += n
+	return n, nil
 }
 
+// 保证缓存区里面至少有n个字节, 只支持线性模式, 环形模式返回ErrRingMode
+// 环形模式下数据可能绕回缓存区开头, 使用Peek和Discard
 func (b *FixedReader) ReadN(n int) (rvn int, err error) {
+	if b.ring {
+		return 0, ErrRingMode
+	}
 	if cap(*b.buf) < n {
-		panic("fixedReader.Reader buf size is too small: cap(b.buf) < n")
+		return 0, ErrBufferTooSmall
 	}
 
 	if n == 0 {
@@ -203,6 +330,140 @@ func (b *FixedReader) ReadN(n int) (rvn int, err error) {
 	}
 }
 
+// 返回接下来的n个字节, 不会移动读的位置, 返回的数据在下一次读之前有效
+// 少于n个字节时会返回错误, n比整个缓存区还大时返回ErrBufferTooSmall
+func (b *FixedReader) Peek(n int) ([]byte, error) {
+	if n < 0 {
+		return nil, ErrNegativeCount
+	}
+	if n > len(*b.buf) {
+		return nil, ErrBufferTooSmall
+	}
+
+	for b.Buffered() < n && b.err == nil {
+		if !b.ring && b.R+n > len(*b.buf) {
+			b.LeftMove()
+		}
+		b.fill()
+	}
+
+	if avail := b.Buffered(); avail < n {
+		return b.peek(avail), b.readErr()
+	}
+	return b.peek(n), nil
+}
+
+// 跳过n个字节, n可以比缓存区大
+func (b *FixedReader) Discard(n int) (discarded int, err error) {
+	if n < 0 {
+		return 0, ErrNegativeCount
+	}
+
+	remain := n
+	for {
+		skip := b.Buffered()
+		if skip > remain {
+			skip = remain
+		}
+		b.R += skip
+		remain -= skip
+		if remain == 0 {
+			return n, nil
+		}
+		if b.err != nil {
+			return n - remain, b.readErr()
+		}
+		b.fill()
+	}
+}
+
+func (b *FixedReader) ReadByte() (byte, error) {
+	for b.R == b.W {
+		if b.err != nil {
+			return 0, b.readErr()
+		}
+		b.fill()
+	}
+
+	first, _ := b.segments()
+	b.R++
+	return first[0], nil
+}
+
+// 读到delim为止, 返回的数据包含delim, 在下一次读之前有效
+// 缓存区满了也没有找到delim, 返回整个缓存区的数据和ErrBufferFull
+func (b *FixedReader) ReadSlice(delim byte) (line []byte, err error) {
+	// 已经找过的字节数, 相对b.R
+	scanned := 0
+	for {
+		if i := b.indexByte(scanned, delim); i >= 0 {
+			line = b.peek(i + 1)
+			b.R += i + 1
+			return line, nil
+		}
+
+		if b.err != nil {
+			line = b.peek(b.Buffered())
+			b.R = b.W
+			return line, b.readErr()
+		}
+
+		if b.Buffered() == len(*b.buf) {
+			line = b.peek(b.Buffered())
+			b.R = b.W
+			return line, ErrBufferFull
+		}
+
+		scanned = b.Buffered()
+		b.fill()
+	}
+}
+
+// 从第from个缓存的字节开始找c, 返回相对b.R的位置
+func (b *FixedReader) indexByte(from int, c byte) int {
+	first, second := b.segments()
+	if from < len(first) {
+		if i := bytes.IndexByte(first[from:], c); i >= 0 {
+			return from + i
+		}
+		from = len(first)
+	}
+
+	if i := bytes.IndexByte(second[from-len(first):], c); i >= 0 {
+		return from + i
+	}
+	return -1
+}
+
+// 实现io.WriterTo, 把缓存的数据和rd剩下的数据都写到w
+func (b *FixedReader) WriteTo(w io.Writer) (n int64, err error) {
+	for {
+		first, second := b.segments()
+		for _, p := range [2][]byte{first, second} {
+			if len(p) == 0 {
+				continue
+			}
+			m, err := w.Write(p)
+			n += int64(m)
+			b.R += m
+			if err == nil && m < len(p) {
+				err = io.ErrShortWrite
+			}
+			if err != nil {
+				return n, err
+			}
+		}
+
+		if b.err != nil {
+			if err = b.readErr(); err == io.EOF {
+				err = nil
+			}
+			return n, err
+		}
+		b.fill()
+	}
+}
+
 func (b *FixedReader) ResetReader(r io.Reader) {
 	b.rd = r
 }
@@ -17,7 +17,9 @@ package fixedreader
 import (
 	"errors"
 	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 type testFixedReaderFail struct{}
@@ -76,3 +78,166 @@ func Test_FixedReader(t *testing.T) {
 		}
 	})
 }
+
+// 线性模式和环形模式的结果要一样, 小缓存区加一个字节一个字节的读, 环形模式会绕回开头
+func newTestReaders(data string, size int) map[string]*FixedReader {
+	readers := map[string]*FixedReader{}
+	for _, name := range []string{"linear", "ring", "linear.one.byte", "ring.one.byte"} {
+		var rd io.Reader = strings.NewReader(data)
+		if strings.HasSuffix(name, "one.byte") {
+			rd = iotest.OneByteReader(rd)
+		}
+		buf := make([]byte, size)
+		if strings.HasPrefix(name, "ring") {
+			readers[name] = NewRingReader(rd, &buf)
+		} else {
+			readers[name] = NewFixedReader(rd, &buf)
+		}
+	}
+	return readers
+}
+
+func Test_FixedReader_Methods(t *testing.T) {
+	const data = "hello\nwebsocket\nring buffer\nend"
+
+	tests := []struct {
+		name string
+		size int
+		run  func(r *FixedReader) (string, error)
+		want string
+	}{
+		{
+			name: "ReadSlice",
+			size: 16,
+			run: func(r *FixedReader) (got string, err error) {
+				for {
+					line, err := r.ReadSlice('\n')
+					got += string(line) + "|"
+					if err != nil {
+						return got, err
+					}
+				}
+			},
+			want: "hello\n|websocket\n|ring buffer\n|end|",
+		},
+		{
+			name: "ReadByte",
+			size: 7,
+			run: func(r *FixedReader) (got string, err error) {
+				for {
+					c, err := r.ReadByte()
+					if err != nil {
+						return got, err
+					}
+					got += string(c)
+				}
+			},
+			want: data,
+		},
+		{
+			name: "Peek.Discard",
+			size: 8,
+			run: func(r *FixedReader) (got string, err error) {
+				for {
+					p, err := r.Peek(5)
+					got += string(p) + "|"
+					if err != nil {
+						return got, err
+					}
+					if _, err = r.Discard(3); err != nil {
+						return got, err
+					}
+				}
+			},
+			want: "hello|lo\nwe|webso|socke|ket\nr|\nring|ng bu|buffe|fer\ne|\nend|",
+		},
+		{
+			name: "Discard.large",
+			size: 4,
+			run: func(r *FixedReader) (string, error) {
+				if n, err := r.Discard(16); n != 16 || err != nil {
+					return "", err
+				}
+				p, err := r.Peek(4)
+				if err == nil {
+					err = io.EOF
+				}
+				return string(p), err
+			},
+			want: "ring",
+		},
+		{
+			name: "Read",
+			size: 9,
+			run: func(r *FixedReader) (got string, err error) {
+				p := make([]byte, 6)
+				for {
+					if _, err = r.Read(p); err != nil {
+						return got, err
+					}
+					got += string(p)
+				}
+			},
+			want: data[:len(data)/6*6],
+		},
+		{
+			name: "WriteTo",
+			size: 5,
+			run: func(r *FixedReader) (string, error) {
+				r.ReadByte()
+				var out strings.Builder
+				n, err := r.WriteTo(&out)
+				if int(n) != out.Len() {
+					return "", errors.New("bad count")
+				}
+				if err == nil {
+					err = io.EOF
+				}
+				return out.String(), err
+			},
+			want: data[1:],
+		},
+	}
+
+	for _, tt := range tests {
+		for name, r := range newTestReaders(data, tt.size) {
+			got, err := tt.run(r)
+			if err != io.EOF {
+				t.Fatalf("%s.%s: got err %v, want io.EOF", tt.name, name, err)
+			}
+			if got != tt.want {
+				t.Fatalf("%s.%s: got %q, want %q", tt.name, name, got, tt.want)
+			}
+		}
+	}
+}
+
+func Test_FixedReader_Error(t *testing.T) {
+	for name, r := range newTestReaders("hello world", 4) {
+		if _, err := r.Read(make([]byte, 5)); err != ErrBufferTooSmall {
+			t.Fatalf("%s: Read got %v, want %v", name, err, ErrBufferTooSmall)
+		}
+		if _, err := r.Peek(5); err != ErrBufferTooSmall {
+			t.Fatalf("%s: Peek got %v, want %v", name, err, ErrBufferTooSmall)
+		}
+		if _, err := r.Peek(-1); err != ErrNegativeCount {
+			t.Fatalf("%s: Peek got %v, want %v", name, err, ErrNegativeCount)
+		}
+		if line, err := r.ReadSlice('\n'); err != ErrBufferFull || string(line) != "hell" {
+			t.Fatalf("%s: ReadSlice got %q %v, want %v", name, line, err, ErrBufferFull)
+		}
+
+		// 环形模式不支持ReadN, 缓存区的数据不能动
+		want := error(nil)
+		if r.IsRing() {
+			want = ErrRingMode
+		}
+		buffered := r.Buffered()
+		if _, err := r.ReadN(2); err != want {
+			t.Fatalf("%s: ReadN got %v, want %v", name, err, want)
+		}
+		if r.IsRing() && r.Buffered() != buffered {
+			t.Fatalf("%s: ReadN changed buffered %d -> %d", name, buffered, r.Buffered())
+		}
+	}
+}
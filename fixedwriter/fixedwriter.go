@@ -13,11 +13,36 @@
 // limitations under the License.
 package fixedwriter
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+
+	"github.com/antlabs/wsutil/bytespool"
+)
+
+// 缓存区放不下的时候怎么处理
+type Mode uint8
+
+const (
+	// 直接panic, 默认的行为
+	ModePanic Mode = iota
+	// 什么都不写, 返回io.ErrShortBuffer
+	ModeError
+	// 从bytespool换一块更大的内存, 旧的如果也是从bytespool来的(ResetPooled), 放回池子里
+	ModeGrow
+)
+
+// ReadFrom每次至少要有这么多空闲空间
+const minReadSize = 512
 
 type FixedWriter struct {
-	buf []byte
-	w   int
+	buf  []byte
+	w    int
+	mode Mode
+
+	// buf是从bytespool拿的, 换内存或者Free的时候放回去
+	// 调用者通过Reset给的内存不会放回去, 由调用者自己处理
+	pooled *[]byte
 }
 
 func NewFixedWriter(buf []byte) *FixedWriter {
@@ -26,34 +51,146 @@ func NewFixedWriter(buf []byte) *FixedWriter {
 	}
 }
 
+// 同NewFixedWriter, 可以指定缓存区不够时的处理方式
+func NewFixedWriterMode(buf []byte, mode Mode) *FixedWriter {
+	return &FixedWriter{
+		buf:  buf,
+		mode: mode,
+	}
+}
+
+// 设置缓存区不够时的处理方式, Reset和Free不会改变mode
+func (fw *FixedWriter) SetMode(mode Mode) {
+	fw.mode = mode
+}
+
 func (fw *FixedWriter) SetW(w int) {
 	fw.w = w
 }
 
 func (fw *FixedWriter) Reset(buf []byte) {
+	fw.putPooled()
 	fw.buf = buf
 	fw.w = 0
 }
 
+// 同Reset, buf是bytespool.GetBytes拿到的, 所有权交给fw
+// 换内存或者Free的时候, fw会调用bytespool.PutBytes放回去
+func (fw *FixedWriter) ResetPooled(buf *[]byte) {
+	fw.Reset(*buf)
+	fw.pooled = buf
+}
+
 func (fw *FixedWriter) Write(p []byte) (n int, err error) {
-	if len(fw.buf[fw.w:]) < len(p) {
-		panic(fmt.Sprintf("fixedWriter: buf is too small: len(%d):cap(%d) < len(%d)", len(fw.buf[fw.w:]), cap(fw.buf), len(p)))
+	if err = fw.ensure(len(p)); err != nil {
+		return 0, err
 	}
 	n = copy(fw.buf[fw.w:], p)
 	fw.w += n
 	return n, nil
 }
 
+// 实现io.StringWriter, 不需要先转成[]byte
+func (fw *FixedWriter) WriteString(s string) (n int, err error) {
+	if err = fw.ensure(len(s)); err != nil {
+		return 0, err
+	}
+	n = copy(fw.buf[fw.w:], s)
+	fw.w += n
+	return n, nil
+}
+
+// 实现io.ByteWriter
+func (fw *FixedWriter) WriteByte(c byte) error {
+	if err := fw.ensure(1); err != nil {
+		return err
+	}
+	fw.buf[fw.w] = c
+	fw.w++
+	return nil
+}
+
+// 实现io.ReaderFrom, 读到io.EOF为止, io.EOF不会返回
+// 缓存区满了还没有读到io.EOF时, ModeGrow会换一块更大的内存, 其他的mode返回io.ErrShortBuffer, 不会panic
+// 满了之后不会再从r读, r剩下的数据保持原样, 所以刚好写满的时候也会返回io.ErrShortBuffer
+func (fw *FixedWriter) ReadFrom(r io.Reader) (n int64, err error) {
+	for {
+		if fw.Available() == 0 {
+			if fw.mode != ModeGrow {
+				return n, io.ErrShortBuffer
+			}
+			fw.grow(minReadSize)
+		}
+
+		n1, err := r.Read(fw.buf[fw.w:])
+		if n1 < 0 {
+			panic("fixedWriter: reader returned negative count from Read")
+		}
+		fw.w += n1
+		n += int64(n1)
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return n, err
+		}
+	}
+}
+
+// 剩下的空间
+func (fw *FixedWriter) Available() int {
+	return len(fw.buf) - fw.w
+}
+
+// 保证至少还有n个字节的空间
+func (fw *FixedWriter) ensure(n int) error {
+	if len(fw.buf[fw.w:]) >= n {
+		return nil
+	}
+
+	switch fw.mode {
+	case ModeError:
+		return io.ErrShortBuffer
+	case ModeGrow:
+		fw.grow(n)
+		return nil
+	}
+	panic(fmt.Sprintf("fixedWriter: buf is too small: len(%d):cap(%d) < len(%d)", len(fw.buf[fw.w:]), cap(fw.buf), n))
+}
+
+// 换一块能多放下n个字节的内存, 至少是原来的2倍
+func (fw *FixedWriter) grow(n int) {
+	size := 2 * len(fw.buf)
+	if size < fw.w+n {
+		size = fw.w + n
+	}
+
+	newBuf := bytespool.GetBytes(size)
+	copy(*newBuf, fw.buf[:fw.w])
+	fw.putPooled()
+	fw.buf = *newBuf
+	fw.pooled = newBuf
+}
+
+func (fw *FixedWriter) putPooled() {
+	if fw.pooled != nil {
+		bytespool.PutBytes(fw.pooled)
+		fw.pooled = nil
+	}
+}
+
 func (fw *FixedWriter) Len() int {
 	return fw.w
 }
 
+// 换过内存之后, 之前返回的[]byte就不能再用了
 func (fw *FixedWriter) Bytes() []byte {
 	return fw.buf[:fw.w]
 }
 
-// 释放
+// 释放, 从bytespool拿的内存会放回去
 func (fw *FixedWriter) Free() {
+	fw.putPooled()
 	fw.buf = nil
 	fw.w = 0
 }
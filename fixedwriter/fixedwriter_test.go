@@ -0,0 +1,145 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package fixedwriter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/antlabs/wsutil/bytespool"
+)
+
+func Test_FixedWriter_Mode(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      Mode
+		wantErr   error
+		wantPanic bool
+	}{
+		{name: "panic", mode: ModePanic, wantPanic: true},
+		{name: "error", mode: ModeError, wantErr: io.ErrShortBuffer},
+		{name: "grow", mode: ModeGrow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); (r != nil) != tt.wantPanic {
+					t.Errorf("panic = %v, wantPanic %v", r, tt.wantPanic)
+				}
+			}()
+
+			fw := NewFixedWriterMode(make([]byte, 5), tt.mode)
+			defer fw.Free()
+
+			if _, err := fw.WriteString("hello"); err != nil {
+				t.Fatal(err)
+			}
+			n, err := fw.Write([]byte(", world"))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			want := "hello, world"
+			if err != nil {
+				// 出错的时候什么都不写
+				want = "hello"
+				if n != 0 {
+					t.Errorf("n = %d, want 0", n)
+				}
+			}
+			if string(fw.Bytes()) != want {
+				t.Errorf("Bytes() = %q, want %q", fw.Bytes(), want)
+			}
+
+			// 缓存区是满的
+			if err = fw.WriteByte('!'); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("WriteByte err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_FixedWriter_ReadFrom(t *testing.T) {
+	data := strings.Repeat("0123456789", 300)
+	tests := []struct {
+		name    string
+		mode    Mode
+		size    int
+		wantErr error
+	}{
+		{name: "fit", mode: ModeError, size: len(data) + 1},
+		// 写满了没有办法知道r是不是读完了
+		{name: "exact", mode: ModeError, size: len(data), wantErr: io.ErrShortBuffer},
+		{name: "short", mode: ModeError, size: 100, wantErr: io.ErrShortBuffer},
+		{name: "short.panic mode", mode: ModePanic, size: 100, wantErr: io.ErrShortBuffer},
+		{name: "grow", mode: ModeGrow, size: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fw := NewFixedWriterMode(make([]byte, tt.size), tt.mode)
+			defer fw.Free()
+
+			sr := strings.NewReader(data)
+			n, err := fw.ReadFrom(iotest.OneByteReader(sr))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if int(n) != fw.Len() {
+				t.Errorf("n = %d, Len() = %d", n, fw.Len())
+			}
+
+			// 写进去的加上r里面剩下的, 一个字节都不能少
+			rest, _ := io.ReadAll(sr)
+			if got := string(fw.Bytes()) + string(rest); got != data {
+				t.Errorf("got %d+%d bytes, want %d", fw.Len(), len(rest), len(data))
+			}
+		})
+	}
+}
+
+// 从bytespool拿的内存换掉之后会放回去, 调用者的内存不会
+func Test_FixedWriter_Grow(t *testing.T) {
+	var fw FixedWriter
+	fw.SetMode(ModeGrow)
+
+	own := make([]byte, 4)
+	fw.Reset(own)
+	fw.WriteString("abcd")
+	if fw.pooled != nil {
+		t.Fatal("caller's buf should not be pooled")
+	}
+
+	fw.WriteString("efgh")
+	first := fw.pooled
+	if first == nil || string(fw.Bytes()) != "abcdefgh" {
+		t.Fatalf("Bytes() = %q", fw.Bytes())
+	}
+
+	fw.Write(bytes.Repeat([]byte("x"), 4096))
+	if fw.pooled == first || fw.Len() != 8+4096 {
+		t.Fatalf("pooled = %p, first = %p, Len() = %d", fw.pooled, first, fw.Len())
+	}
+
+	fw.ResetPooled(bytespool.GetBytes(16))
+	fw.Free()
+	if fw.pooled != nil || fw.Len() != 0 {
+		t.Fatal("Free should release the pooled buf")
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package frame
+
+import (
+	"github.com/antlabs/wsutil/bytespool"
+	"github.com/antlabs/wsutil/limitreader"
+	"github.com/antlabs/wsutil/opcode"
+	"github.com/antlabs/wsutil/utf8check"
+)
+
+var (
+	ErrContinuationWithoutStart = &ProtocolError{msg: "frame: continuation frame without start frame"}
+	ErrDataFrameInFragment      = &ProtocolError{msg: "frame: data frame while a fragmented message is in progress"}
+	ErrInvalidRsv1              = &ProtocolError{msg: "frame: rsv1 is only allowed on the first frame of a data message"}
+)
+
+// 解压缩接口, *deflate.DeCompressContextTakeover 实现了这个接口
+type Decompressor interface {
+	Decompress(payload *[]byte, maxMessage int64) (*[]byte, error)
+}
+
+// 一个完整的消息
+type Message struct {
+	Opcode opcode.Opcode
+	// 从bytespool里面分配的, 用完之后调用Free
+	Payload *[]byte
+}
+
+// 把Payload放回bytespool
+func (m *Message) Free() {
+	if m.Payload != nil {
+		bytespool.PutBytes(m.Payload)
+		m.Payload = nil
+	}
+}
+
+// Assembler 把frame组装成完整的消息
+// 分片中间收到的控制帧会直接返回, 不影响正在组装的消息
+// https://datatracker.ietf.org/doc/html/rfc6455#section-5.4
+type Assembler struct {
+	// 消息的最大长度, 0表示不限制
+	MaxMessage int64
+
+	// 协商了permessage-deflate之后设置, 只看第一个frame的RSV1
+	// https://datatracker.ietf.org/doc/html/rfc7692#section-6.1
+	Decompressor Decompressor
+
+	// 检查text消息是不是合法的utf-8, 出错返回utf8check.ErrInvalidUTF8
+	// 没有压缩的消息每收到一个frame就检查一次, 不用等整个消息收完
+	CheckUTF8 bool
+
+	utf8       utf8check.Checker
+	op         opcode.Opcode
+	fragmented bool // 是否有正在组装的消息
+	compressed bool // 正在组装的消息是否被压缩
+	buf        *[]byte
+	n          int
+}
+
+// 输入一个frame, ok为true时, m是一个完整的消息
+func (a *Assembler) Push(f Frame) (m Message, ok bool, err error) {
+	return a.push(&f.FrameHeader, f.Payload)
+}
+
+// 同Push, 输入的是Frame2
+func (a *Assembler) PushV2(f Frame2) (m Message, ok bool, err error) {
+	var payload []byte
+	if f.Payload != nil {
+		payload = *f.Payload
+	}
+	return a.push(&f.FrameHeader, payload)
+}
+
+func (a *Assembler) push(h *FrameHeader, payload []byte) (m Message, ok bool, err error) {
+	if h.Opcode.IsControl() {
+		if h.GetRsv1() {
+			return m, false, ErrInvalidRsv1
+		}
+		// 控制帧不能分片, 直接返回
+		m.Opcode = h.Opcode
+		m.Payload = bytespool.GetBytes(len(payload))
+		*m.Payload = (*m.Payload)[:copy(*m.Payload, payload)]
+		return m, true, nil
+	}
+
+	if h.Opcode == opcode.Continuation {
+		if !a.fragmented {
+			return m, false, ErrContinuationWithoutStart
+		}
+		if h.GetRsv1() {
+			a.Reset()
+			return m, false, ErrInvalidRsv1
+		}
+	} else {
+		if a.fragmented {
+			a.Reset()
+			return m, false, ErrDataFrameInFragment
+		}
+		if h.GetRsv1() && a.Decompressor == nil {
+			return m, false, ErrRsvNotNegotiated
+		}
+		a.op = h.Opcode
+		a.compressed = h.GetRsv1()
+		a.utf8.Reset()
+	}
+
+	if a.MaxMessage > 0 && int64(a.n+len(payload)) > a.MaxMessage {
+		a.Reset()
+		return m, false, limitreader.ErrTooBigMessage
+	}
+
+	a.append(payload)
+	if a.needCheckUTF8() && !a.compressed {
+		if err = a.utf8.Feed(payload); err != nil {
+			a.Reset()
+			return m, false, err
+		}
+	}
+
+	if !h.GetFin() {
+		a.fragmented = true
+		return m, false, nil
+	}
+
+	compressed := a.compressed
+	checkUTF8 := a.needCheckUTF8()
+	m.Opcode = a.op
+	m.Payload = a.take()
+	if compressed {
+		// 整个消息收完之后再解压缩
+		var out *[]byte
+		out, err = a.Decompressor.Decompress(m.Payload, a.MaxMessage)
+		m.Free()
+		if err != nil {
+			return m, false, err
+		}
+		m.Payload = out
+
+		if checkUTF8 {
+			err = a.utf8.Feed(*m.Payload)
+		}
+	}
+
+	if checkUTF8 {
+		if err == nil {
+			err = a.utf8.Finish()
+		}
+		if err != nil {
+			m.Free()
+			return m, false, err
+		}
+	}
+
+	return m, true, nil
+}
+
+func (a *Assembler) needCheckUTF8() bool {
+	return a.CheckUTF8 && a.op == opcode.Text
+}
+
+func (a *Assembler) append(payload []byte) {
+	if a.buf == nil {
+		a.buf = bytespool.GetBytes(len(payload))
+	} else if cap(*a.buf)-a.n < len(payload) {
+		// 空间不够, 换一块大的
+		newBuf := bytespool.GetBytes((a.n + len(payload)) * 2)
+		copy(*newBuf, (*a.buf)[:a.n])
+		bytespool.PutBytes(a.buf)
+		a.buf = newBuf
+	}
+
+	a.n += copy((*a.buf)[a.n:cap(*a.buf)], payload)
+}
+
+// 取出组装好的消息, buf的所有权交给调用者
+func (a *Assembler) take() *[]byte {
+	if a.buf == nil {
+		a.buf = bytespool.GetBytes(0)
+	}
+	buf := a.buf
+	*buf = (*buf)[:a.n]
+	a.buf = nil
+	a.n = 0
+	a.fragmented = false
+	a.compressed = false
+	return buf
+}
+
+// 丢弃正在组装的消息
+func (a *Assembler) Reset() {
+	if a.buf != nil {
+		bytespool.PutBytes(a.buf)
+		a.buf = nil
+	}
+	a.n = 0
+	a.fragmented = false
+	a.compressed = false
+}
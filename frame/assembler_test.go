@@ -0,0 +1,228 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package frame
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/antlabs/wsutil/deflate"
+	"github.com/antlabs/wsutil/limitreader"
+	"github.com/antlabs/wsutil/opcode"
+	"github.com/antlabs/wsutil/utf8check"
+)
+
+func newTestFrame(fin bool, rsv1 bool, op opcode.Opcode, payload string) Frame {
+	var f Frame
+	if fin {
+		f.Head |= 1 << 7
+	}
+	if rsv1 {
+		f.Head |= 1 << 6
+	}
+	f.Head |= byte(op)
+	f.Opcode = op
+	f.PayloadLen = int64(len(payload))
+	f.Payload = []byte(payload)
+	return f
+}
+
+func Test_Assembler(t *testing.T) {
+	t.Run("fragmented.with.ping", func(t *testing.T) {
+		var a Assembler
+		frames := []Frame{
+			newTestFrame(false, false, opcode.Text, "hel"),
+			newTestFrame(true, false, opcode.Ping, "ping"),
+			newTestFrame(false, false, opcode.Continuation, "lo "),
+			newTestFrame(true, false, opcode.Continuation, "world"),
+		}
+
+		var got []Message
+		for _, f := range frames {
+			m, ok, err := a.Push(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok {
+				got = append(got, m)
+			}
+		}
+
+		if len(got) != 2 {
+			t.Fatalf("got %d messages, want 2", len(got))
+		}
+		if got[0].Opcode != opcode.Ping || string(*got[0].Payload) != "ping" {
+			t.Fatalf("got %v:%s, want ping", got[0].Opcode, *got[0].Payload)
+		}
+		if got[1].Opcode != opcode.Text || string(*got[1].Payload) != "hello world" {
+			t.Fatalf("got %v:%s, want hello world", got[1].Opcode, *got[1].Payload)
+		}
+		for i := range got {
+			got[i].Free()
+		}
+	})
+
+	t.Run("big.message", func(t *testing.T) {
+		var a Assembler
+		part := string(bytes.Repeat([]byte("a"), 3000))
+		for i := 0; i < 9; i++ {
+			op := opcode.Continuation
+			if i == 0 {
+				op = opcode.Binary
+			}
+			if _, ok, err := a.Push(newTestFrame(false, false, op, part)); err != nil || ok {
+				t.Fatalf("ok = %v, err = %v", ok, err)
+			}
+		}
+		m, ok, err := a.Push(newTestFrame(true, false, opcode.Continuation, part))
+		if err != nil || !ok {
+			t.Fatalf("ok = %v, err = %v", ok, err)
+		}
+		if m.Opcode != opcode.Binary || len(*m.Payload) != 30000 {
+			t.Fatalf("got %v:%d", m.Opcode, len(*m.Payload))
+		}
+		m.Free()
+	})
+
+	t.Run("continuation.without.start", func(t *testing.T) {
+		var a Assembler
+		_, _, err := a.Push(newTestFrame(true, false, opcode.Continuation, "x"))
+		if err != ErrContinuationWithoutStart {
+			t.Fatalf("got %v, want %v", err, ErrContinuationWithoutStart)
+		}
+	})
+
+	t.Run("data.in.fragment", func(t *testing.T) {
+		var a Assembler
+		if _, _, err := a.Push(newTestFrame(false, false, opcode.Text, "x")); err != nil {
+			t.Fatal(err)
+		}
+		_, _, err := a.Push(newTestFrame(true, false, opcode.Binary, "y"))
+		if err != ErrDataFrameInFragment {
+			t.Fatalf("got %v, want %v", err, ErrDataFrameInFragment)
+		}
+	})
+
+	t.Run("max.message", func(t *testing.T) {
+		a := Assembler{MaxMessage: 5}
+		if _, _, err := a.Push(newTestFrame(false, false, opcode.Text, "hel")); err != nil {
+			t.Fatal(err)
+		}
+		_, _, err := a.Push(newTestFrame(true, false, opcode.Continuation, "lo!"))
+		if err != limitreader.ErrTooBigMessage {
+			t.Fatalf("got %v, want %v", err, limitreader.ErrTooBigMessage)
+		}
+	})
+
+	t.Run("rsv1.without.decompressor", func(t *testing.T) {
+		var a Assembler
+		_, _, err := a.Push(newTestFrame(true, true, opcode.Text, "x"))
+		if err != ErrRsvNotNegotiated {
+			t.Fatalf("got %v, want %v", err, ErrRsvNotNegotiated)
+		}
+	})
+
+	t.Run("compressed.fragmented", func(t *testing.T) {
+		payload := bytes.Repeat([]byte("hello websocket "), 100)
+		var en *deflate.CompressContextTakeover
+		encode, err := en.Compress(&payload, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var de *deflate.DeCompressContextTakeover
+		a := Assembler{Decompressor: de}
+		half := len(*encode) / 2
+		if _, _, err := a.Push(newTestFrame(false, true, opcode.Text, string((*encode)[:half]))); err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = a.Push(newTestFrame(true, true, opcode.Continuation, string((*encode)[half:])))
+		if err != ErrInvalidRsv1 {
+			t.Fatalf("got %v, want %v", err, ErrInvalidRsv1)
+		}
+
+		if _, _, err := a.Push(newTestFrame(false, true, opcode.Text, string((*encode)[:half]))); err != nil {
+			t.Fatal(err)
+		}
+		m, ok, err := a.Push(newTestFrame(true, false, opcode.Continuation, string((*encode)[half:])))
+		if err != nil || !ok {
+			t.Fatalf("ok = %v, err = %v", ok, err)
+		}
+		if !bytes.Equal(*m.Payload, payload) {
+			t.Fatalf("got %s, want %s", *m.Payload, payload)
+		}
+		m.Free()
+	})
+}
+
+func Test_Assembler_UTF8(t *testing.T) {
+	t.Run("split.code.point", func(t *testing.T) {
+		a := Assembler{CheckUTF8: true}
+		// "中" = e4 b8 ad, 切到两个frame里面
+		if _, _, err := a.Push(newTestFrame(false, false, opcode.Text, "hello \xe4\xb8")); err != nil {
+			t.Fatal(err)
+		}
+		m, ok, err := a.Push(newTestFrame(true, false, opcode.Continuation, "\xad"))
+		if err != nil || !ok {
+			t.Fatalf("ok = %v, err = %v", ok, err)
+		}
+		if string(*m.Payload) != "hello 中" {
+			t.Fatalf("got %s", *m.Payload)
+		}
+		m.Free()
+	})
+
+	t.Run("fail.fast", func(t *testing.T) {
+		a := Assembler{CheckUTF8: true}
+		// 第一个frame就是非法的, 不用等到FIN
+		_, _, err := a.Push(newTestFrame(false, false, opcode.Text, "hello \xff"))
+		if err != utf8check.ErrInvalidUTF8 {
+			t.Fatalf("got %v, want %v", err, utf8check.ErrInvalidUTF8)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		a := Assembler{CheckUTF8: true}
+		_, _, err := a.Push(newTestFrame(true, false, opcode.Text, "hello \xe4\xb8"))
+		if err != utf8check.ErrInvalidUTF8 {
+			t.Fatalf("got %v, want %v", err, utf8check.ErrInvalidUTF8)
+		}
+	})
+
+	t.Run("binary.not.checked", func(t *testing.T) {
+		a := Assembler{CheckUTF8: true}
+		m, ok, err := a.Push(newTestFrame(true, false, opcode.Binary, "\xff"))
+		if err != nil || !ok {
+			t.Fatalf("ok = %v, err = %v", ok, err)
+		}
+		m.Free()
+	})
+
+	t.Run("compressed", func(t *testing.T) {
+		payload := []byte("hello \xff world")
+		var en *deflate.CompressContextTakeover
+		encode, err := en.Compress(&payload, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var de *deflate.DeCompressContextTakeover
+		a := Assembler{CheckUTF8: true, Decompressor: de}
+		_, _, err = a.Push(newTestFrame(true, true, opcode.Text, string(*encode)))
+		if err != utf8check.ErrInvalidUTF8 {
+			t.Fatalf("got %v, want %v", err, utf8check.ErrInvalidUTF8)
+		}
+	})
+}
@@ -18,6 +18,8 @@ import (
 	"fmt"
 	"io"
 	"testing"
+	"testing/iotest"
+	"unsafe"
 
 	"github.com/antlabs/wsutil/bytespool"
 	"github.com/antlabs/wsutil/enum"
@@ -286,3 +288,53 @@ func Test_Windows_Read(t *testing.T) {
 		}
 	})
 }
+
+// 环形模式, 大小不一的frame连续读, 会绕回缓存区开头, 也会换大的缓存区
+func Test_Windows_Read_Ring(t *testing.T) {
+	var out bytes.Buffer
+	var want [][]byte
+	for i := 0; i < 600; i += 7 {
+		payload := make([]byte, i)
+		for j := range payload {
+			payload[j] = byte(i + j)
+		}
+		want = append(want, payload)
+		if err := WriteFrameToBytes(&out, payload, true, false, i%2 == 0, opcode.Binary, 0x12345678); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"all", "one.byte"} {
+		var rd io.Reader = bytes.NewReader(out.Bytes())
+		if name == "one.byte" {
+			rd = iotest.OneByteReader(rd)
+		}
+		r := fixedreader.NewRingReader(rd, bytespool.GetBytes(256+enum.MaxFrameHeaderSize))
+
+		var headArray [enum.MaxFrameHeaderSize]byte
+		for i, w := range want {
+			f, err := ReadFrameFromWindowsV2(r, &headArray, 1.0, 0)
+			if err != nil {
+				t.Fatalf("%s: frame %d: %v", name, i, err)
+			}
+			if !bytes.Equal(*f.Payload, w) {
+				t.Fatalf("%s: frame %d: payload mismatch", name, i)
+			}
+
+			// 前面的frame没有绕回, 直接指向缓存区
+			if i == 1 && !inBuf(*f.Payload, r.Bytes()) {
+				t.Fatalf("%s: payload is not zero-copy", name)
+			}
+		}
+
+		if _, err := ReadFrameFromWindowsV2(r, &headArray, 1.0, 0); err != io.EOF {
+			t.Fatalf("%s: got %v, want io.EOF", name, err)
+		}
+	}
+}
+
+func inBuf(p, buf []byte) bool {
+	start := uintptr(unsafe.Pointer(unsafe.SliceData(buf)))
+	ptr := uintptr(unsafe.Pointer(unsafe.SliceData(p)))
+	return ptr >= start && ptr < start+uintptr(len(buf))
+}
@@ -58,6 +58,21 @@ type Frame struct {
 }
 
 func ReadHeader(r io.Reader, headArray *[enum.MaxFrameHeaderSize]byte) (h FrameHeader, size int, err error) {
+	var v *Validator
+	return v.ReadHeader(r, headArray)
+}
+
+// 读取frame header, 并且使用v检查header是否合法, v为nil时不检查
+func (v *Validator) ReadHeader(r io.Reader, headArray *[enum.MaxFrameHeaderSize]byte) (h FrameHeader, size int, err error) {
+	if h, size, err = readHeader(r, headArray); err != nil {
+		return
+	}
+
+	err = v.Validate(&h)
+	return
+}
+
+func readHeader(r io.Reader, headArray *[enum.MaxFrameHeaderSize]byte) (h FrameHeader, size int, err error) {
 	// var headArray [enum.MaxFrameHeaderSize]byte
 	head := (*headArray)[:2]
 
@@ -116,6 +131,10 @@ func ReadHeader(r io.Reader, headArray *[enum.MaxFrameHeaderSize]byte) (h FrameH
 	case 127:
 		h.PayloadLen = int64(binary.BigEndian.Uint64(head[:8]))
 		head = head[8:]
+		// 最高位必须是0, 不然转成int64就是负数
+		if h.PayloadLen < 0 {
+			return h, size, ErrPayloadLengthMSB
+		}
 	}
 
 	if h.Mask {
@@ -156,7 +175,7 @@ func WriteHeader(head []byte, fin bool, rsv1, rsv2, rsv3 bool, code opcode.Opcod
 	}
 
 	if rsv3 {
-		head[0] |= 1 << 5
+		head[0] |= 1 << 4
 	}
 
 	head[0] |= byte(code & 0xF)
@@ -196,12 +215,12 @@ func WriteFrame(fw *fixedwriter.FixedWriter, w io.Writer, payload []byte, fin bo
 	}
 
 	fw.SetW(wIndex)
-	_, err = fw.Write(payload)
-	if err != nil {
-		goto free
-	}
 	if isMask {
-		mask.Mask(fw.Bytes()[wIndex:], maskValue)
+		// 拷贝和mask一次完成, payload不会被修改
+		mask.MaskTo((*buf)[wIndex:], payload, maskValue)
+		fw.SetW(wIndex + len(payload))
+	} else if _, err = fw.Write(payload); err != nil {
+		goto free
 	}
 
 	_, err = w.Write(fw.Bytes())
@@ -0,0 +1,155 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package frame
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/antlabs/wsutil/bytespool"
+	"github.com/antlabs/wsutil/enum"
+	"github.com/antlabs/wsutil/fixedreader"
+	"github.com/antlabs/wsutil/opcode"
+)
+
+// fuzz的种子, testdata下面已有的frame数据和几个边界的header
+// testdata/fuzz下面capture_开头的语料是gorilla/websocket, coder/websocket, gws和node的WebSocket在本机互相连接抓的包,
+// 客户端和服务端两个方向的frame都有, synthetic_开头的是手工构造的, 和抓包内容一样的只保留synthetic_的那份
+// 重新抓包生成capture_语料: cd testdata/capture && go run .
+func addFrameSeeds(f *testing.F) {
+	for _, name := range []string{"./testdata/binary_1024.dat", "./testdata/binary_2048.dat"} {
+		all, err := os.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(all)
+	}
+	f.Add(noMaskData)
+	f.Add(haveMaskData)
+	f.Add([]byte{0x89, 0x00})                                     // ping
+	f.Add([]byte{0x88, 0x02, 0x03, 0xe8})                         // close 1000
+	f.Add([]byte{0x82, 0x7e, 0x00})                               // 16位长度不完整
+	f.Add([]byte{0x82, 0x7f, 0x80, 0, 0, 0, 0, 0, 0, 0})          // 64位长度最高位是1
+	f.Add([]byte{0xf2, 0xff, 0, 0, 0, 0, 0, 0, 0x01, 0x00, 1, 2}) // rsv全部是1, 有mask
+}
+
+// 任意输入不能panic, 解析成功的header重新编码之后要和输入一样
+func FuzzReadHeader(f *testing.F) {
+	addFrameSeeds(f)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var headArray [enum.MaxFrameHeaderSize]byte
+		h, size, err := ReadHeader(bytes.NewReader(data), &headArray)
+		if err != nil {
+			return
+		}
+
+		var v Validator
+		_ = v.Validate(&h)
+
+		var head [enum.MaxFrameHeaderSize]byte
+		have, err := WriteHeader(head[:], h.GetFin(), h.GetRsv1(), h.GetRsv2(), h.GetRsv3(), h.Opcode, int(h.PayloadLen), h.Mask, h.MaskKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 长度不是最短编码时, 重新编码会比输入短, 只比较解析出来的字段
+		h2, size2, err := ReadHeader(bytes.NewReader(head[:have]), &headArray)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h2 != h {
+			t.Fatalf("got %#v, want %#v", h2, h)
+		}
+		if size2 != have || size2 > size {
+			t.Fatalf("size2 = %d, have = %d, size = %d", size2, have, size)
+		}
+	})
+}
+
+// WriteHeader之后ReadHeader, 得到的字段和写入的一样
+func FuzzWriteHeader(f *testing.F) {
+	f.Add(true, false, false, false, uint8(opcode.Text), 5, false, uint32(0))
+	f.Add(true, true, false, false, uint8(opcode.Binary), 1024, true, uint32(0x12345678))
+	f.Add(false, false, true, true, uint8(opcode.Continuation), 1<<16, true, uint32(0xffffffff))
+	f.Add(true, false, false, true, uint8(opcode.Close), 125, false, uint32(0))
+
+	f.Fuzz(func(t *testing.T, fin, rsv1, rsv2, rsv3 bool, code uint8, payloadLen int, isMask bool, maskValue uint32) {
+		if payloadLen < 0 {
+			return
+		}
+
+		var head [enum.MaxFrameHeaderSize]byte
+		have, err := WriteHeader(head[:], fin, rsv1, rsv2, rsv3, opcode.Opcode(code&0xF), payloadLen, isMask, maskValue)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var headArray [enum.MaxFrameHeaderSize]byte
+		h, size, err := ReadHeader(bytes.NewReader(head[:have]), &headArray)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if size != have {
+			t.Fatalf("size = %d, have = %d", size, have)
+		}
+		if h.GetFin() != fin || h.GetRsv1() != rsv1 || h.GetRsv2() != rsv2 || h.GetRsv3() != rsv3 {
+			t.Fatalf("head = %08b, fin = %t, rsv = %t %t %t", h.Head, fin, rsv1, rsv2, rsv3)
+		}
+		if h.Opcode != opcode.Opcode(code&0xF) || h.PayloadLen != int64(payloadLen) || h.Mask != isMask {
+			t.Fatalf("got %#v", h)
+		}
+		if isMask && h.MaskKey != maskValue {
+			t.Fatalf("maskKey = %x, want %x", h.MaskKey, maskValue)
+		}
+	})
+}
+
+// 任意输入不能panic, 读到的payload不能超过maxPayload
+// 线性模式和环形模式的FixedReader读到的frame要一样
+func FuzzReadFrameFromWindowsV2(f *testing.F) {
+	addFrameSeeds(f)
+
+	const maxPayload = 1 << 20
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := fixedreader.NewFixedReader(bytes.NewReader(data), bytespool.GetBytes(1024+enum.MaxFrameHeaderSize))
+		ring := fixedreader.NewRingReader(bytes.NewReader(data), bytespool.GetBytes(1024+enum.MaxFrameHeaderSize))
+		// 读大的frame时r会换一块buf, 旧的放回池子里, 这里放回的是最后一块
+		defer func() {
+			bytespool.PutBytes(r.BufPtr())
+			bytespool.PutBytes(ring.BufPtr())
+			ring.Release()
+		}()
+
+		var headArray [enum.MaxFrameHeaderSize]byte
+		for i := 0; i < 8; i++ {
+			f, err := ReadFrameFromWindowsV2(r, &headArray, 1.0, maxPayload)
+			f2, err2 := ReadFrameFromWindowsV2(ring, &headArray, 1.0, maxPayload)
+			if (err == nil) != (err2 == nil) {
+				t.Fatalf("frame %d: linear err = %v, ring err = %v", i, err, err2)
+			}
+			if err != nil {
+				return
+			}
+			if int64(len(*f.Payload)) != f.PayloadLen || f.PayloadLen > maxPayload {
+				t.Fatalf("len(payload) = %d, payloadLen = %d", len(*f.Payload), f.PayloadLen)
+			}
+			if f.FrameHeader != f2.FrameHeader || !bytes.Equal(*f.Payload, *f2.Payload) {
+				t.Fatalf("frame %d: linear %+v, ring %+v", i, f.FrameHeader, f2.FrameHeader)
+			}
+		}
+	})
+}
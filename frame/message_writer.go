@@ -0,0 +1,148 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package frame
+
+import (
+	"errors"
+	"io"
+
+	"github.com/antlabs/wsutil/bytespool"
+	"github.com/antlabs/wsutil/enum"
+	"github.com/antlabs/wsutil/mask"
+	"github.com/antlabs/wsutil/opcode"
+)
+
+// 默认的分片大小
+const DefaultFragmentSize = 1024 * 16
+
+var ErrMessageWriterClosed = errors.New("frame: message writer closed")
+
+// MessageWriter 把一个消息切成多个frame写出去
+// 第一个frame使用真实的opcode, 后面的都是Continuation, 最后一个frame在Close的时候写出, FIN=1
+// 缓存区只需要fragmentSize + 14个字节, 不再需要和消息一样大
+type MessageWriter struct {
+	w            io.Writer
+	op           opcode.Opcode
+	fragmentSize int
+	isClient     bool
+	rsv1         bool
+	first        bool
+	closed       bool
+
+	// 写失败之后缓存区里面的数据已经mask过了, 连接上也可能写了半个frame
+	// 之后的Write和Close都直接返回这个错误
+	err error
+
+	// 前14个字节预留给frame header
+	buf *[]byte
+	n   int
+}
+
+// rsv1 表示写入的数据已经压缩过了, 只在第一个frame上设置
+func NewMessageWriter(w io.Writer, op opcode.Opcode, fragmentSize int, isClient bool, rsv1 bool) *MessageWriter {
+	if fragmentSize <= 0 {
+		fragmentSize = DefaultFragmentSize
+	}
+
+	return &MessageWriter{
+		w:            w,
+		op:           op,
+		fragmentSize: fragmentSize,
+		isClient:     isClient,
+		rsv1:         rsv1,
+		first:        true,
+		buf:          bytespool.GetBytes(fragmentSize + enum.MaxFrameHeaderSize),
+		n:            enum.MaxFrameHeaderSize,
+	}
+}
+
+// 实现io.Writer接口, 凑满一个分片就写出去
+func (m *MessageWriter) Write(p []byte) (n int, err error) {
+	if m.closed {
+		return 0, ErrMessageWriterClosed
+	}
+	if m.err != nil {
+		return 0, m.err
+	}
+
+	for len(p) > 0 {
+		if m.n-enum.MaxFrameHeaderSize == m.fragmentSize {
+			if err = m.flushFrame(false); err != nil {
+				return n, err
+			}
+		}
+
+		n1 := copy((*m.buf)[m.n:enum.MaxFrameHeaderSize+m.fragmentSize], p)
+		m.n += n1
+		n += n1
+		p = p[n1:]
+	}
+	return n, nil
+}
+
+// 写出最后一个frame, 并且把缓存区放回池子里
+// 之前写失败过的话不再写, 返回之前的错误
+func (m *MessageWriter) Close() (err error) {
+	if m.closed {
+		return ErrMessageWriterClosed
+	}
+
+	err = m.err
+	if err == nil {
+		err = m.flushFrame(true)
+	}
+	m.closed = true
+	bytespool.PutBytes(m.buf)
+	m.buf = nil
+	return err
+}
+
+func (m *MessageWriter) flushFrame(fin bool) (err error) {
+	op := opcode.Continuation
+	rsv1 := false
+	if m.first {
+		op = m.op
+		rsv1 = m.rsv1
+	}
+
+	// 每个分片都使用新的mask key
+	maskValue := uint32(0)
+	if m.isClient {
+		maskValue = mask.NewKey()
+	}
+
+	payload := (*m.buf)[enum.MaxFrameHeaderSize:m.n]
+	var head [enum.MaxFrameHeaderSize]byte
+	have, err := WriteHeader(head[:], fin, rsv1, false, false, op, len(payload), m.isClient, maskValue)
+	if err != nil {
+		m.err = err
+		return err
+	}
+
+	// header紧贴着payload放, 一次write写出去
+	start := enum.MaxFrameHeaderSize - have
+	copy((*m.buf)[start:], head[:have])
+	if m.isClient {
+		mask.Mask(payload, maskValue)
+	}
+
+	if _, err = m.w.Write((*m.buf)[start:m.n]); err != nil {
+		m.err = err
+		return err
+	}
+
+	m.first = false
+	m.n = enum.MaxFrameHeaderSize
+	return nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package frame
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/antlabs/wsutil/deflate"
+	"github.com/antlabs/wsutil/enum"
+	"github.com/antlabs/wsutil/opcode"
+)
+
+func Test_MessageWriter(t *testing.T) {
+	t.Run("client.fragment", func(t *testing.T) {
+		var out bytes.Buffer
+		payload := bytes.Repeat([]byte("0123456789"), 5000)
+
+		w := NewMessageWriter(&out, opcode.Binary, 1024, true, false)
+		// 分多次写, 每次的大小和分片大小不对齐
+		for p := payload; len(p) > 0; {
+			n := 777
+			if n > len(p) {
+				n = len(p)
+			}
+			if _, err := w.Write(p[:n]); err != nil {
+				t.Fatal(err)
+			}
+			p = p[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte("x")); err != ErrMessageWriterClosed {
+			t.Fatalf("got %v, want %v", err, ErrMessageWriterClosed)
+		}
+
+		v := &Validator{NeedMask: true}
+		var a Assembler
+		var headArray [enum.MaxFrameHeaderSize]byte
+		var buf []byte
+		var maskKeys []uint32
+		for i := 0; ; i++ {
+			f, err := v.ReadFrameFromReader(&out, &headArray, &buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantOp := opcode.Continuation
+			if i == 0 {
+				wantOp = opcode.Binary
+			}
+			if f.Opcode != wantOp {
+				t.Fatalf("index:%d, opcode %v, want %v", i, f.Opcode, wantOp)
+			}
+			maskKeys = append(maskKeys, f.MaskKey)
+
+			m, ok, err := a.Push(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				if len(f.Payload) != 1024 {
+					t.Fatalf("index:%d, fragment size %d, want 1024", i, len(f.Payload))
+				}
+				continue
+			}
+
+			if !bytes.Equal(*m.Payload, payload) {
+				t.Fatal("payload not equal")
+			}
+			m.Free()
+			break
+		}
+
+		if len(maskKeys) != (len(payload)+1023)/1024 {
+			t.Fatalf("got %d frames", len(maskKeys))
+		}
+		if maskKeys[0] == maskKeys[1] && maskKeys[1] == maskKeys[2] {
+			t.Fatal("mask key should be fresh for each fragment")
+		}
+	})
+
+	t.Run("server.rsv1", func(t *testing.T) {
+		payload := bytes.Repeat([]byte("hello websocket "), 1000)
+		var en *deflate.CompressContextTakeover
+		encode, err := en.Compress(&payload, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out bytes.Buffer
+		w := NewMessageWriter(&out, opcode.Text, 16, false, true)
+		if _, err := w.Write(*encode); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		var de *deflate.DeCompressContextTakeover
+		v := &Validator{Rsv1: true}
+		a := Assembler{Decompressor: de}
+		var headArray [enum.MaxFrameHeaderSize]byte
+		var buf []byte
+		for i := 0; ; i++ {
+			f, err := v.ReadFrameFromReader(&out, &headArray, &buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.GetRsv1() != (i == 0) {
+				t.Fatalf("index:%d, rsv1 = %v", i, f.GetRsv1())
+			}
+
+			m, ok, err := a.Push(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok {
+				if !bytes.Equal(*m.Payload, payload) {
+					t.Fatal("payload not equal")
+				}
+				m.Free()
+				break
+			}
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		var out bytes.Buffer
+		w := NewMessageWriter(&out, opcode.Text, 0, false, false)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out.Bytes(), []byte{0x81, 0x00}) {
+			t.Fatalf("got %v", out.Bytes())
+		}
+	})
+
+	// 写失败之后, 后面的Write和Close都返回同样的错误, 不会再写连接
+	t.Run("write.error", func(t *testing.T) {
+		errWrite := errors.New("write failed")
+		w := &failWriter{ok: 1, err: errWrite}
+		mw := NewMessageWriter(w, opcode.Binary, 1024, true, false)
+		if _, err := mw.Write(make([]byte, 3000)); err != errWrite {
+			t.Fatalf("got %v, want %v", err, errWrite)
+		}
+		if _, err := mw.Write([]byte("x")); err != errWrite {
+			t.Fatalf("got %v, want %v", err, errWrite)
+		}
+		if err := mw.Close(); err != errWrite {
+			t.Fatalf("got %v, want %v", err, errWrite)
+		}
+		if err := mw.Close(); err != ErrMessageWriterClosed {
+			t.Fatalf("got %v, want %v", err, ErrMessageWriterClosed)
+		}
+		if w.calls != 2 {
+			t.Fatalf("write calls = %d, want 2", w.calls)
+		}
+	})
+}
+
+// 前ok次Write成功, 之后都返回err
+type failWriter struct {
+	ok    int
+	calls int
+	err   error
+}
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	w.calls++
+	if w.calls > w.ok {
+		return 0, w.err
+	}
+	return len(p), nil
+}
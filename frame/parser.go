@@ -0,0 +1,245 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package frame
+
+import (
+	"errors"
+	"math"
+
+	"github.com/antlabs/wsutil/bytespool"
+	"github.com/antlabs/wsutil/enum"
+	"github.com/antlabs/wsutil/fixedreader"
+	"github.com/antlabs/wsutil/mask"
+)
+
+var ErrParserClosed = errors.New("frame: parser closed")
+
+// Parser 推送式的frame解析, 给epoll/netpoll这类事件驱动的服务端使用
+//
+// 收到多少数据就调用一次Feed, 不会阻塞, 不完整的header和payload留在缓存区里面, 等下一次Feed
+// 缓存区使用的是FixedReader, 和ReadFrameFromWindowsV2一样, payload放不下的时候从bytespool换一块大的
+//
+// 每解析出一个frame调用一次OnFrame, 设置了Assembler时, 组装成完整的消息之后调用OnMessage
+// OnFrame拿到的payload指向Parser的缓存区, 回调返回之后就不能再使用了
+// 回调返回错误时, Feed马上返回这个错误, 之后的Feed都返回同样的错误, 一般需要关闭连接
+type Parser struct {
+	// 为nil时不检查header
+	Validator *Validator
+
+	// payload的最大长度, 0表示DefaultMaxPayload, 超过返回ErrTooLargePayload
+	// payload的长度是对端给的, 需要先分配这么大的缓存区, 所以不能不限制
+	// 注意和ReadFrameFromWindowsV2的maxPayload不一样, 那边0表示不限制
+	MaxPayload int64
+
+	OnFrame func(f Frame2) error
+
+	Assembler *Assembler
+	OnMessage func(m Message) error
+
+	r         fixedreader.FixedReader
+	headArray [enum.MaxFrameHeaderSize]byte
+
+	// 已经解析了header, 等payload
+	h       FrameHeader
+	haveHdr bool
+	err     error
+
+	// 缓存区是从bytespool拿的, 只有这种才还回去, 调用方传进来的buf归调用方
+	pooled bool
+}
+
+// buf为nil时从bytespool里面拿一块
+// 调用方传入的buf不会还给bytespool, 缓存区不够换了大的之后, Parser不再使用它
+func NewParser(buf *[]byte) *Parser {
+	p := &Parser{}
+	p.Init(buf)
+	return p
+}
+
+// 初始化, Parser可以嵌到连接的结构体里面, 不用单独分配
+func (p *Parser) Init(buf *[]byte) {
+	p.pooled = false
+	if buf == nil || len(*buf) < enum.MaxFrameHeaderSize {
+		buf = bytespool.GetBytes(1024 + enum.MaxFrameHeaderSize)
+		p.pooled = true
+	}
+	p.r.Init(nil, buf)
+	p.r.R, p.r.W = 0, 0
+	p.haveHdr = false
+	p.err = nil
+}
+
+// 输入收到的数据, 可以是任意长度, 可以在frame的任意位置切开
+// data在Feed返回之后就可以复用
+func (p *Parser) Feed(data []byte) error {
+	if p.err != nil {
+		return p.err
+	}
+
+	for len(data) > 0 {
+		if p.r.WriteCap() == 0 {
+			p.r.LeftMove()
+			if p.r.WriteCap() == 0 {
+				p.grow(p.r.Len() * 2)
+			}
+		}
+
+		n := copy(p.r.WriteCapBytes(), data)
+		p.r.W += n
+		data = data[n:]
+
+		if err := p.parse(); err != nil {
+			p.err = err
+			return err
+		}
+	}
+	return nil
+}
+
+// 解析缓存区里面所有完整的frame
+func (p *Parser) parse() error {
+	for {
+		if !p.haveHdr {
+			buf := p.r.Bytes()[p.r.R:p.r.W]
+			if len(buf) < 2 || len(buf) < headerSize(buf[1]) {
+				// header还不完整, 缓存区至少有14个字节, 放得下
+				if p.r.Len()-p.r.R < enum.MaxFrameHeaderSize {
+					p.r.LeftMove()
+				}
+				return nil
+			}
+
+			// 数据是够的, 不会去读底层的io.Reader
+			h, _, err := p.Validator.ReadHeader(&p.r, &p.headArray)
+			if err != nil {
+				return err
+			}
+
+			if h.PayloadLen > p.maxPayload() {
+				return ErrTooLargePayload
+			}
+			p.h, p.haveHdr = h, true
+		}
+
+		need := int(p.h.PayloadLen)
+		if p.r.W-p.r.R < need {
+			// payload还不完整, 保证缓存区放得下整个payload
+			// 和ReadFrameFromWindowsV2一样, 已经收到的数据不用算进去
+			switch {
+			case int64(need-p.r.Buffered()) > p.r.Available():
+				p.grow(need + enum.MaxFrameHeaderSize)
+			case need > p.r.Len()-p.r.R:
+				p.r.LeftMove()
+			}
+			return nil
+		}
+
+		payload := p.r.Bytes()[p.r.R : p.r.R+need]
+		p.r.R += need
+		p.haveHdr = false
+		if p.h.Mask {
+			mask.Mask(payload, p.h.MaskKey)
+		}
+
+		if err := p.emit(Frame2{FrameHeader: p.h, Payload: &payload}); err != nil {
+			return err
+		}
+
+		if p.r.R == p.r.W {
+			p.r.R, p.r.W = 0, 0
+		}
+	}
+}
+
+func (p *Parser) emit(f Frame2) error {
+	if p.OnFrame != nil {
+		if err := p.OnFrame(f); err != nil {
+			return err
+		}
+	}
+
+	if p.Assembler == nil {
+		return nil
+	}
+
+	m, ok, err := p.Assembler.PushV2(f)
+	if err != nil || !ok {
+		return err
+	}
+
+	if p.OnMessage == nil {
+		m.Free()
+		return nil
+	}
+	return p.OnMessage(m)
+}
+
+// 加上header的长度也不会超过int的范围
+func (p *Parser) maxPayload() int64 {
+	max := p.MaxPayload
+	if max <= 0 {
+		max = DefaultMaxPayload
+	}
+	if limit := int64(math.MaxInt - enum.MaxFrameHeaderSize); max > limit {
+		max = limit
+	}
+	return max
+}
+
+// 换一块至少n个字节的缓存区, 没有处理的数据会拷贝过去
+func (p *Parser) grow(n int) {
+	oldBuf := p.r.BufPtr()
+	p.r.Reset(bytespool.GetBytes(n))
+	if p.pooled {
+		bytespool.PutBytes(oldBuf)
+	}
+	p.pooled = true
+}
+
+// 还没有处理的数据长度
+func (p *Parser) Buffered() int {
+	return p.r.Buffered()
+}
+
+// 把缓存区还给bytespool, 之后的Feed返回ErrParserClosed
+// 缓存区是调用方传入的buf时不会放回bytespool
+func (p *Parser) Release() {
+	if buf := p.r.BufPtr(); buf != nil {
+		if p.pooled {
+			bytespool.PutBytes(buf)
+		}
+		p.r.Release()
+	}
+	p.pooled = false
+	p.err = ErrParserClosed
+	if p.Assembler != nil {
+		p.Assembler.Reset()
+	}
+}
+
+// 根据header的第二个字节(MASK和payload len), 计算header的长度
+func headerSize(b1 byte) int {
+	size := 2
+	if b1&(1<<7) > 0 {
+		size += 4
+	}
+
+	switch b1 & 0x7F {
+	case 126:
+		size += 2
+	case 127:
+		size += 8
+	}
+	return size
+}
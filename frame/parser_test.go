@@ -0,0 +1,219 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package frame
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/antlabs/wsutil/bytespool"
+	"github.com/antlabs/wsutil/enum"
+	"github.com/antlabs/wsutil/fixedreader"
+	"github.com/antlabs/wsutil/opcode"
+)
+
+type parsedFrame struct {
+	fin     bool
+	op      opcode.Opcode
+	payload string
+}
+
+func Test_Parser(t *testing.T) {
+	big := string(bytes.Repeat([]byte("0123456789"), 10000))
+
+	var stream bytes.Buffer
+	var want []parsedFrame
+	add := func(fin bool, op opcode.Opcode, payload string) {
+		if err := WriteFrameToBytes(&stream, []byte(payload), fin, false, true, op, 0x11223344); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, parsedFrame{fin: fin, op: op, payload: payload})
+	}
+
+	add(true, opcode.Text, "hello")
+	add(false, opcode.Text, "frag")
+	add(true, opcode.Ping, "")
+	add(false, opcode.Continuation, "ment")
+	add(true, opcode.Continuation, "ed")
+	add(true, opcode.Binary, string(bytes.Repeat([]byte("a"), 300)))
+	add(true, opcode.Binary, big)
+	add(true, opcode.Text, "bye")
+
+	for _, chunk := range []int{1, 2, 3, 7, 100, 4096, stream.Len()} {
+		t.Run(fmt.Sprintf("chunk.%d", chunk), func(t *testing.T) {
+			var got []parsedFrame
+			var msgs []string
+			p := NewParser(nil)
+			p.Validator = &Validator{NeedMask: true}
+			p.Assembler = &Assembler{CheckUTF8: true}
+			p.OnFrame = func(f Frame2) error {
+				got = append(got, parsedFrame{fin: f.GetFin(), op: f.Opcode, payload: string(*f.Payload)})
+				return nil
+			}
+			p.OnMessage = func(m Message) error {
+				msgs = append(msgs, fmt.Sprintf("%d:%d", m.Opcode, len(*m.Payload)))
+				m.Free()
+				return nil
+			}
+			defer p.Release()
+
+			data := stream.Bytes()
+			for len(data) > 0 {
+				n := chunk
+				if n > len(data) {
+					n = len(data)
+				}
+				if err := p.Feed(data[:n]); err != nil {
+					t.Fatal(err)
+				}
+				data = data[n:]
+			}
+
+			if len(got) != len(want) {
+				t.Fatalf("got %d frames, want %d", len(got), len(want))
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Fatalf("index:%d, got %v, want %v", i, got[i].op, want[i].op)
+				}
+			}
+
+			wantMsgs := []string{"1:5", "9:0", "1:10", "2:300", fmt.Sprintf("2:%d", len(big)), "1:3"}
+			if fmt.Sprint(msgs) != fmt.Sprint(wantMsgs) {
+				t.Fatalf("got messages %v, want %v", msgs, wantMsgs)
+			}
+
+			if p.Buffered() != 0 {
+				t.Fatalf("buffered %d bytes", p.Buffered())
+			}
+		})
+	}
+}
+
+func Test_Parser_Error(t *testing.T) {
+	var stream bytes.Buffer
+	WriteFrameToBytes(&stream, bytes.Repeat([]byte("a"), 200), true, false, true, opcode.Binary, 1)
+
+	t.Run("max.payload", func(t *testing.T) {
+		p := NewParser(nil)
+		p.MaxPayload = 100
+		defer p.Release()
+		if err := p.Feed(stream.Bytes()[:3]); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Feed(stream.Bytes()[3:]); err != ErrTooLargePayload {
+			t.Fatalf("got %v, want %v", err, ErrTooLargePayload)
+		}
+		// 错误会一直返回
+		if err := p.Feed([]byte{0x81}); err != ErrTooLargePayload {
+			t.Fatalf("got %v, want %v", err, ErrTooLargePayload)
+		}
+	})
+
+	// 没有设置MaxPayload时使用默认值, 对端给的长度不能直接拿来分配内存
+	t.Run("default.max.payload", func(t *testing.T) {
+		for _, n := range []uint64{DefaultMaxPayload + 1, 1 << 40, math.MaxInt64} {
+			head := []byte{0x82, 127, 0, 0, 0, 0, 0, 0, 0, 0}
+			binary.BigEndian.PutUint64(head[2:], n)
+			p := NewParser(nil)
+			if err := p.Feed(head); err != ErrTooLargePayload {
+				t.Fatalf("len = %d: got %v, want %v", n, err, ErrTooLargePayload)
+			}
+			p.Release()
+
+			// ReadFrameFromWindowsV2传DefaultMaxPayload时结果一样
+			var headArray [enum.MaxFrameHeaderSize]byte
+			r := fixedreader.NewFixedReader(bytes.NewReader(head), bytespool.GetBytes(1024+enum.MaxFrameHeaderSize))
+			if _, err := ReadFrameFromWindowsV2(r, &headArray, 1.0, DefaultMaxPayload); err != ErrTooLargePayload {
+				t.Fatalf("len = %d: got %v, want %v", n, err, ErrTooLargePayload)
+			}
+		}
+
+		// MaxPayload很大的时候, 加上header的长度也不能溢出
+		p := NewParser(nil)
+		p.MaxPayload = math.MaxInt64
+		head := []byte{0x82, 127, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+		if err := p.Feed(head); err != ErrTooLargePayload {
+			t.Fatalf("got %v, want %v", err, ErrTooLargePayload)
+		}
+		p.Release()
+	})
+
+	t.Run("validator", func(t *testing.T) {
+		p := NewParser(nil)
+		p.Validator = &Validator{}
+		defer p.Release()
+		if err := p.Feed(stream.Bytes()); err != ErrMaskNotAllowed {
+			t.Fatalf("got %v, want %v", err, ErrMaskNotAllowed)
+		}
+	})
+
+	t.Run("callback", func(t *testing.T) {
+		errStop := errors.New("stop")
+		p := NewParser(nil)
+		p.OnFrame = func(f Frame2) error { return errStop }
+		defer p.Release()
+		if err := p.Feed(stream.Bytes()); err != errStop {
+			t.Fatalf("got %v, want %v", err, errStop)
+		}
+	})
+
+	// 调用方传入的buf不能放回bytespool, Parser自己拿的才放回去
+	t.Run("caller.buf", func(t *testing.T) {
+		puts := func() (n int64) {
+			st := bytespool.ReadStats()
+			for _, c := range st.Classes {
+				n += c.Puts
+			}
+			return n + st.Dropped
+		}
+		bytespool.EnableStats(true)
+		defer bytespool.EnableStats(false)
+
+		var big bytes.Buffer
+		WriteFrameToBytes(&big, make([]byte, 3000), true, false, true, opcode.Binary, 1)
+
+		for _, tt := range []struct {
+			name string
+			data []byte
+			want int64
+		}{
+			{name: "small", data: stream.Bytes(), want: 0},
+			{name: "grow", data: big.Bytes(), want: 1},
+		} {
+			bytespool.ResetStats()
+			buf := make([]byte, 1024+enum.MaxFrameHeaderSize)
+			p := NewParser(&buf)
+			if err := p.Feed(tt.data); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			p.Release()
+			if got := puts(); got != tt.want {
+				t.Fatalf("%s: puts = %d, want %d", tt.name, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("released", func(t *testing.T) {
+		p := NewParser(nil)
+		p.Release()
+		if err := p.Feed(stream.Bytes()); err != ErrParserClosed {
+			t.Fatalf("got %v, want %v", err, ErrParserClosed)
+		}
+	})
+}
@@ -0,0 +1,175 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package frame
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/antlabs/wsutil/bytespool"
+	"github.com/antlabs/wsutil/deflate"
+	"github.com/antlabs/wsutil/enum"
+	"github.com/antlabs/wsutil/opcode"
+)
+
+var ErrPreparedMessageReleased = errors.New("frame: prepared message released")
+
+// 一种编码方式
+type preparedKey struct {
+	compress   bool
+	windowBits uint8
+}
+
+// PreparedMessage 广播使用, 同一个消息发给很多连接的时候, 每种编码方式只编码一次
+// 缓存的是完整的frame(header + payload), 服务端发送的, 没有mask
+//
+// 编码方式有两种:
+//   - 不压缩
+//   - 压缩, 上下文不接管, 每个server_max_window_bits一份
+//
+// 上下文接管的连接, 压缩结果和连接的历史数据有关, 不能共享, 需要单独调用WriteFrame
+//
+// 可以在多个go程里面同时调用WriteTo, 写连接的时候不持有锁, 慢的连接不会影响别的连接
+// Release可以在任何时候调用, 缓存等最后一个正在执行的WriteTo返回之后再放回bytespool
+type PreparedMessage struct {
+	op      opcode.Opcode
+	payload *[]byte
+	n       int
+	policy  deflate.Policy
+
+	mu       sync.Mutex
+	frames   map[preparedKey]*[]byte
+	released bool
+	// 正在写的WriteTo个数
+	writing int
+}
+
+// payload会被拷贝一份, 调用之后payload可以复用
+// 压缩使用deflate.DefaultPolicy
+func NewPreparedMessage(op opcode.Opcode, payload []byte) *PreparedMessage {
+	return NewPreparedMessagePolicy(op, payload, &deflate.DefaultPolicy)
+}
+
+// 同NewPreparedMessage, 压缩使用policy的压缩级别, 和连接(deflate.Extension)使用同一个Policy时, 压缩结果一样
+// 小于policy.MinSize的消息不压缩, 压缩的时候也写成普通的frame, 自适应由调用者决定WriteTo的compress参数
+func NewPreparedMessagePolicy(op opcode.Opcode, payload []byte, policy *deflate.Policy) *PreparedMessage {
+	buf := bytespool.GetBytes(len(payload))
+	n := copy(*buf, payload)
+	return &PreparedMessage{
+		op:      op,
+		payload: buf,
+		n:       n,
+		policy:  *policy,
+		frames:  make(map[preparedKey]*[]byte, 2),
+	}
+}
+
+// 把消息写到w里面
+// compress为true时, 使用permessage-deflate(上下文不接管)压缩, windowBits是协商的server_max_window_bits, 0表示15
+func (pm *PreparedMessage) WriteTo(w io.Writer, compress bool, windowBits uint8) error {
+	key := preparedKey{compress: compress && pm.n >= pm.policy.MinSize, windowBits: windowBits}
+	if !key.compress {
+		key.windowBits = 0
+	}
+
+	data, err := pm.acquire(key)
+	if err != nil {
+		return err
+	}
+	defer pm.done()
+
+	_, err = w.Write(*data)
+	return err
+}
+
+// 拿到key对应的frame, 第一次使用这种编码方式时编码一次
+// 成功的时候writing加1, 写完之后要调用done
+func (pm *PreparedMessage) acquire(key preparedKey) (data *[]byte, err error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if pm.released {
+		return nil, ErrPreparedMessageReleased
+	}
+
+	data, ok := pm.frames[key]
+	if !ok {
+		if data, err = pm.encode(key); err != nil {
+			return nil, err
+		}
+		pm.frames[key] = data
+	}
+	pm.writing++
+	return data, nil
+}
+
+// 一个WriteTo写完了, 已经Release并且是最后一个的时候释放缓存
+func (pm *PreparedMessage) done() {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	pm.writing--
+	if pm.released && pm.writing == 0 {
+		pm.free()
+	}
+}
+
+// 调用的时候要持有锁
+func (pm *PreparedMessage) encode(key preparedKey) (buf *[]byte, err error) {
+	payload := (*pm.payload)[:pm.n]
+	if key.compress {
+		var en *deflate.CompressContextTakeover
+		var out *[]byte
+		if out, err = en.CompressLevel(&payload, pm.policy.CompressionLevel(), key.windowBits); err != nil {
+			return nil, err
+		}
+		defer bytespool.PutBytes(out)
+		payload = *out
+	}
+
+	buf = bytespool.GetBytes(len(payload) + enum.MaxFrameHeaderSize)
+	have, err := WriteHeader(*buf, true, key.compress, false, false, pm.op, len(payload), false, 0)
+	if err != nil {
+		bytespool.PutBytes(buf)
+		return nil, err
+	}
+	*buf = (*buf)[:have+copy((*buf)[have:], payload)]
+	return buf, nil
+}
+
+// 之后的WriteTo返回ErrPreparedMessageReleased
+// 不会等正在执行的WriteTo, 最后一个WriteTo返回的时候才把缓存放回bytespool
+func (pm *PreparedMessage) Release() {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.released {
+		return
+	}
+
+	pm.released = true
+	if pm.writing == 0 {
+		pm.free()
+	}
+}
+
+// 调用的时候要持有锁
+func (pm *PreparedMessage) free() {
+	for k, buf := range pm.frames {
+		bytespool.PutBytes(buf)
+		delete(pm.frames, k)
+	}
+	bytespool.PutBytes(pm.payload)
+	pm.payload = nil
+}
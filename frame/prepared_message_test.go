@@ -0,0 +1,209 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package frame
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/antlabs/wsutil/deflate"
+	"github.com/antlabs/wsutil/enum"
+	"github.com/antlabs/wsutil/opcode"
+)
+
+func Test_PreparedMessage(t *testing.T) {
+	payload := []byte(strings.Repeat("broadcast ", 300))
+	pm := NewPreparedMessage(opcode.Text, payload)
+
+	t.Run("uncompressed", func(t *testing.T) {
+		var want bytes.Buffer
+		if err := WriteFrameToBytes(&want, payload, true, false, false, opcode.Text, 0); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 2; i++ {
+			var got bytes.Buffer
+			if err := pm.WriteTo(&got, false, 9); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), want.Bytes()) {
+				t.Fatalf("got %x, want %x", got.Bytes(), want.Bytes())
+			}
+		}
+	})
+
+	t.Run("compressed", func(t *testing.T) {
+		for _, bits := range []uint8{0, 9} {
+			var out bytes.Buffer
+			if err := pm.WriteTo(&out, true, bits); err != nil {
+				t.Fatal(err)
+			}
+
+			var headArray [enum.MaxFrameHeaderSize]byte
+			var buf []byte
+			f, err := ReadFrameFromReader(&out, &headArray, &buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !f.GetFin() || !f.GetRsv1() || f.Opcode != opcode.Text {
+				t.Fatalf("bits:%d, header %#v", bits, f.FrameHeader)
+			}
+
+			var de *deflate.DeCompressContextTakeover
+			got, err := de.Decompress(&f.Payload, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(*got, payload) {
+				t.Fatalf("bits:%d, decoded data mismatch", bits)
+			}
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		var wg sync.WaitGroup
+		outs := make([]bytes.Buffer, 16)
+		for i := range outs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if err := pm.WriteTo(&outs[i], i%2 == 0, 12); err != nil {
+					t.Error(err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		for i := 2; i < len(outs); i++ {
+			if !bytes.Equal(outs[i].Bytes(), outs[i%2].Bytes()) {
+				t.Fatalf("index:%d, output differs", i)
+			}
+		}
+	})
+
+	pm.Release()
+	pm.Release()
+	if err := pm.WriteTo(&bytes.Buffer{}, false, 0); err != ErrPreparedMessageReleased {
+		t.Fatalf("got %v, want %v", err, ErrPreparedMessageReleased)
+	}
+	if err := pm.WriteTo(&bytes.Buffer{}, true, 10); err != ErrPreparedMessageReleased {
+		t.Fatalf("got %v, want %v", err, ErrPreparedMessageReleased)
+	}
+}
+
+// 写到一半卡住的连接
+type blockingWriter struct {
+	entered chan struct{}
+	unblock chan struct{}
+	bytes.Buffer
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	close(w.entered)
+	<-w.unblock
+	return w.Buffer.Write(p)
+}
+
+// 一个连接卡住的时候, 别的连接使用新的编码方式和Release都不能被卡住
+func Test_PreparedMessage_SlowWriter(t *testing.T) {
+	payload := []byte(strings.Repeat("broadcast ", 300))
+	pm := NewPreparedMessage(opcode.Text, payload)
+
+	slow := &blockingWriter{entered: make(chan struct{}), unblock: make(chan struct{})}
+	slowErr := make(chan error, 1)
+	go func() { slowErr <- pm.WriteTo(slow, false, 0) }()
+	<-slow.entered
+
+	progress := make(chan error, 1)
+	go func() {
+		var out bytes.Buffer
+		err := pm.WriteTo(&out, true, 10)
+		pm.Release()
+		progress <- err
+	}()
+
+	select {
+	case err := <-progress:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("WriteTo with a new variant or Release blocked by a slow writer")
+	}
+
+	if err := pm.WriteTo(&bytes.Buffer{}, false, 0); err != ErrPreparedMessageReleased {
+		t.Fatalf("got %v, want %v", err, ErrPreparedMessageReleased)
+	}
+
+	// Release之后, 卡住的写还在使用缓存, 数据不能被改掉
+	close(slow.unblock)
+	if err := <-slowErr; err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	WriteFrameToBytes(&want, payload, true, false, false, opcode.Text, 0)
+	if !bytes.Equal(slow.Bytes(), want.Bytes()) {
+		t.Fatal("slow writer got corrupted data")
+	}
+	if pm.payload != nil || len(pm.frames) != 0 {
+		t.Fatal("buffers should be released after the last WriteTo")
+	}
+}
+
+// 压缩级别和MinSize使用传入的Policy, 和连接正常发送的消息一样
+func Test_PreparedMessage_Policy(t *testing.T) {
+	payload, err := os.ReadFile("../testdata/1.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, level := range []int{1, 9} {
+		policy := deflate.Policy{Level: level}
+		pm := NewPreparedMessagePolicy(opcode.Text, payload, &policy)
+
+		var out bytes.Buffer
+		if err := pm.WriteTo(&out, true, 0); err != nil {
+			t.Fatal(err)
+		}
+		pm.Release()
+
+		var en *deflate.CompressContextTakeover
+		want, err := en.CompressLevel(&payload, level, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wantFrame bytes.Buffer
+		WriteFrameToBytes(&wantFrame, *want, true, true, false, opcode.Text, 0)
+		if !bytes.Equal(out.Bytes(), wantFrame.Bytes()) {
+			t.Fatalf("level %d: prepared frame differs from CompressLevel", level)
+		}
+	}
+
+	// 小于MinSize, 要求压缩也发送普通的frame
+	pm := NewPreparedMessagePolicy(opcode.Text, []byte("hello"), &deflate.Policy{MinSize: 64})
+	defer pm.Release()
+	var out bytes.Buffer
+	if err := pm.WriteTo(&out, true, 0); err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	WriteFrameToBytes(&want, []byte("hello"), true, false, false, opcode.Text, 0)
+	if !bytes.Equal(out.Bytes(), want.Bytes()) {
+		t.Fatalf("got %x, want %x", out.Bytes(), want.Bytes())
+	}
+}
@@ -22,7 +22,13 @@ import (
 )
 
 func ReadFrameFromReader(r io.Reader, headArray *[enum.MaxFrameHeaderSize]byte, buf *[]byte) (f Frame, err error) {
-	h, _, err := ReadHeader(r, headArray)
+	var v *Validator
+	return v.ReadFrameFromReader(r, headArray, buf)
+}
+
+// 同ReadFrameFromReader, 读取header之后会使用v做检查
+func (v *Validator) ReadFrameFromReader(r io.Reader, headArray *[enum.MaxFrameHeaderSize]byte, buf *[]byte) (f Frame, err error) {
+	h, _, err := v.ReadHeader(r, headArray)
 	if err != nil {
 		return f, err
 	}
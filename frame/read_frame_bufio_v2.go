@@ -22,7 +22,13 @@ import (
 )
 
 func ReadFrameFromReaderV2(r io.Reader, headArray *[enum.MaxFrameHeaderSize]byte, buf *[]byte) (f Frame2, err error) {
-	h, _, err := ReadHeader(r, headArray)
+	var v *Validator
+	return v.ReadFrameFromReaderV2(r, headArray, buf)
+}
+
+// 同ReadFrameFromReaderV2, 读取header之后会使用v做检查
+func (v *Validator) ReadFrameFromReaderV2(r io.Reader, headArray *[enum.MaxFrameHeaderSize]byte, buf *[]byte) (f Frame2, err error) {
+	h, _, err := v.ReadHeader(r, headArray)
 	if err != nil {
 		return f, fmt.Errorf("ReadFrameFromReaderV2:%w", err)
 	}
@@ -49,7 +55,13 @@ func ReadFrameFromReaderV2(r io.Reader, headArray *[enum.MaxFrameHeaderSize]byte
 }
 
 func ReadFrameFromReaderV3(r io.Reader, lr io.Reader, headArray *[enum.MaxFrameHeaderSize]byte, buf *[]byte) (f Frame2, err error) {
-	h, _, err := ReadHeader(r, headArray)
+	var v *Validator
+	return v.ReadFrameFromReaderV3(r, lr, headArray, buf)
+}
+
+// 同ReadFrameFromReaderV3, 读取header之后会使用v做检查
+func (v *Validator) ReadFrameFromReaderV3(r io.Reader, lr io.Reader, headArray *[enum.MaxFrameHeaderSize]byte, buf *[]byte) (f Frame2, err error) {
+	h, _, err := v.ReadHeader(r, headArray)
 	if err != nil {
 		return f, fmt.Errorf("ReadFrameFromReaderV2:%w", err)
 	}
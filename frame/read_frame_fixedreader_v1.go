@@ -24,7 +24,26 @@ func ReadFrame(r *fixedreader.FixedReader, headArray *[enum.MaxFrameHeaderSize]b
 	return ReadFrameFromWindows(r, headArray, 1.0)
 }
 
+func (v *Validator) ReadFrame(r *fixedreader.FixedReader, headArray *[enum.MaxFrameHeaderSize]byte) (f Frame, err error) {
+	return v.ReadFrameFromWindows(r, headArray, 1.0)
+}
+
 func ReadFrameFromWindows(r *fixedreader.FixedReader, headArray *[enum.MaxFrameHeaderSize]byte, multipletimes float32 /*几倍的payload*/) (f Frame, err error) {
+	var v *Validator
+	return v.ReadFrameFromWindows(r, headArray, multipletimes)
+}
+
+// 同ReadFrameFromWindows, 读取header之后会使用v做检查
+func (v *Validator) ReadFrameFromWindows(r *fixedreader.FixedReader, headArray *[enum.MaxFrameHeaderSize]byte, multipletimes float32 /*几倍的payload*/) (f Frame, err error) {
+	if r.IsRing() {
+		f2, err := v.readFrameRing(r, headArray, multipletimes, 0)
+		if err != nil {
+			return f, err
+		}
+		f.FrameHeader, f.Payload = f2.FrameHeader, *f2.Payload
+		return f, nil
+	}
+
 	// 如果剩余可写缓存区放不下一个frame header, 就把数据往前移动
 	// 所有的的buf分配都是paydload + frame head 的长度, 挪完之后，肯定是能放下一个frame header的
 	if r.Len()-r.R < enum.MaxFrameHeaderSize {
@@ -34,7 +53,7 @@ func ReadFrameFromWindows(r *fixedreader.FixedReader, headArray *[enum.MaxFrameH
 		}
 	}
 
-	h, _, err := ReadHeader(r, headArray)
+	h, _, err := v.ReadHeader(r, headArray)
 	if err != nil {
 		return f, err
 	}
@@ -24,11 +24,31 @@ import (
 
 var ErrTooLargePayload = errors.New("error:payload too large")
 
+// 建议的payload最大长度, Parser.MaxPayload为0时使用这个值
+// ReadFrameFromWindowsV2的maxPayload为0时不限制, 读对端的数据时可以传这个值
+const DefaultMaxPayload = 16 * 1024 * 1024
+
 func ReadFrameV2(r *fixedreader.FixedReader, headArray *[enum.MaxFrameHeaderSize]byte) (f Frame2, err error) {
 	return ReadFrameFromWindowsV2(r, headArray, 1.0, 0)
 }
 
+func (v *Validator) ReadFrameV2(r *fixedreader.FixedReader, headArray *[enum.MaxFrameHeaderSize]byte) (f Frame2, err error) {
+	return v.ReadFrameFromWindowsV2(r, headArray, 1.0, 0)
+}
+
+// maxPayload是payload的最大长度, 超过返回ErrTooLargePayload, <=0表示不限制
+// 注意和Parser.MaxPayload不一样, Parser的0表示DefaultMaxPayload
 func ReadFrameFromWindowsV2(r *fixedreader.FixedReader, headArray *[enum.MaxFrameHeaderSize]byte, multipletimes float32 /*几倍的payload*/, maxPayload int64) (f Frame2, err error) {
+	var v *Validator
+	return v.ReadFrameFromWindowsV2(r, headArray, multipletimes, maxPayload)
+}
+
+// 同ReadFrameFromWindowsV2, 读取header之后会使用v做检查
+func (v *Validator) ReadFrameFromWindowsV2(r *fixedreader.FixedReader, headArray *[enum.MaxFrameHeaderSize]byte, multipletimes float32 /*几倍的payload*/, maxPayload int64) (f Frame2, err error) {
+	if r.IsRing() {
+		return v.readFrameRing(r, headArray, multipletimes, maxPayload)
+	}
+
 	// 如果剩余可写缓存区放不下一个frame header, 就把数据往前移动
 	// 所有的的buf分配都是paydload + frame head 的长度, 挪完之后，肯定是能放下一个frame header的
 	if r.Len()-r.R < enum.MaxFrameHeaderSize {
@@ -38,7 +58,7 @@ func ReadFrameFromWindowsV2(r *fixedreader.FixedReader, headArray *[enum.MaxFram
 		}
 	}
 
-	h, _, err := ReadHeader(r, headArray)
+	h, _, err := v.ReadHeader(r, headArray)
 	if err != nil {
 		return f, err
 	}
@@ -99,3 +119,38 @@ func ReadFrameFromWindowsV2(r *fixedreader.FixedReader, headArray *[enum.MaxFram
 
 	return f, nil
 }
+
+// 环形模式的FixedReader, 不需要LeftMove
+// payload没有绕回缓存区开头时直接指向缓存区, 绕回了才拷贝一次
+func (v *Validator) readFrameRing(r *fixedreader.FixedReader, headArray *[enum.MaxFrameHeaderSize]byte, multipletimes float32 /*几倍的payload*/, maxPayload int64) (f Frame2, err error) {
+	h, _, err := v.ReadHeader(r, headArray)
+	if err != nil {
+		return f, err
+	}
+
+	if maxPayload > 0 && h.PayloadLen > maxPayload {
+		return f, ErrTooLargePayload
+	}
+
+	// 整个缓存区都放不下, 换一个大的, 已经缓存的数据会拷贝到新buf的开头
+	if h.PayloadLen > int64(r.Len()) {
+		oldBuf := r.BufPtr()
+		r.Reset(bytespool.GetBytes(int(float32(h.PayloadLen+enum.MaxFrameHeaderSize) * multipletimes)))
+		bytespool.PutBytes(oldBuf)
+	}
+
+	payload, err := r.Peek(int(h.PayloadLen))
+	if err != nil {
+		return f, err
+	}
+	// 已经都在缓存区里面了, 不会再读
+	r.Discard(len(payload))
+
+	f.Payload = &payload
+	f.FrameHeader = h
+	if h.Mask {
+		mask.Mask(*f.Payload, h.MaskKey)
+	}
+
+	return f, nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package frame
+
+import (
+	"github.com/antlabs/wsutil/closecode"
+	"github.com/antlabs/wsutil/opcode"
+)
+
+// 控制帧的payload最大长度
+// https://datatracker.ietf.org/doc/html/rfc6455#section-5.5
+const maxControlPayload = 125
+
+// 违反RFC 6455的错误, 收到这类错误, 应该使用1002(protocol error)关闭连接
+type ProtocolError struct {
+	msg string
+}
+
+func (e *ProtocolError) Error() string {
+	return e.msg
+}
+
+// 对应的close状态码
+func (e *ProtocolError) StatusCode() closecode.StatusCode {
+	return closecode.ProtocolError
+}
+
+var (
+	ErrControlFrameFragmented = &ProtocolError{msg: "frame: control frame must not be fragmented"}
+	ErrControlFrameTooLarge   = &ProtocolError{msg: "frame: control frame payload length > 125"}
+	ErrReservedOpcode         = &ProtocolError{msg: "frame: reserved opcode"}
+	ErrRsvNotNegotiated       = &ProtocolError{msg: "frame: rsv bit set without negotiated extension"}
+	ErrPayloadLengthMSB       = &ProtocolError{msg: "frame: the most significant bit of 64-bit payload length must be 0"}
+	ErrMaskRequired           = &ProtocolError{msg: "frame: client frame must be masked"}
+	ErrMaskNotAllowed         = &ProtocolError{msg: "frame: server frame must not be masked"}
+)
+
+// Validator 检查frame header是否符合RFC 6455
+// https://datatracker.ietf.org/doc/html/rfc6455#section-5.2
+//
+// Validator为nil时不做任何检查, ReadFrame*系列函数就是用nil调用的
+type Validator struct {
+	// 允许设置的RSV位, 协商了扩展之后才能打开
+	// 比如permessage-deflate使用的是RSV1
+	Rsv1 bool
+	Rsv2 bool
+	Rsv3 bool
+
+	// 服务端读客户端的frame, 必须有mask, 设置为true
+	// 客户端读服务端的frame, 必须没有mask, 设置为false
+	NeedMask bool
+}
+
+// 检查frame header
+func (v *Validator) Validate(h *FrameHeader) error {
+	if v == nil {
+		return nil
+	}
+
+	if h.PayloadLen < 0 {
+		return ErrPayloadLengthMSB
+	}
+
+	switch {
+	case h.Opcode >= 3 && h.Opcode <= 7, h.Opcode > opcode.Pong:
+		return ErrReservedOpcode
+	}
+
+	if h.Opcode.IsControl() {
+		if !h.GetFin() {
+			return ErrControlFrameFragmented
+		}
+
+		if h.PayloadLen > maxControlPayload {
+			return ErrControlFrameTooLarge
+		}
+	}
+
+	if h.GetRsv1() && !v.Rsv1 || h.GetRsv2() && !v.Rsv2 || h.GetRsv3() && !v.Rsv3 {
+		return ErrRsvNotNegotiated
+	}
+
+	if h.Mask != v.NeedMask {
+		if v.NeedMask {
+			return ErrMaskRequired
+		}
+		return ErrMaskNotAllowed
+	}
+	return nil
+}
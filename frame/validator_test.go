@@ -0,0 +1,94 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package frame
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/antlabs/wsutil/closecode"
+	"github.com/antlabs/wsutil/enum"
+	"github.com/antlabs/wsutil/fixedreader"
+	"github.com/antlabs/wsutil/opcode"
+)
+
+func Test_Validator(t *testing.T) {
+	server := &Validator{NeedMask: true}
+	client := &Validator{}
+	deflate := &Validator{NeedMask: true, Rsv1: true}
+
+	tests := []struct {
+		name    string
+		v       *Validator
+		data    []byte
+		wantErr error
+	}{
+		{name: "text.ok", v: server, data: []byte{0x81, 0x80, 0, 0, 0, 0}},
+		{name: "text.client.ok", v: client, data: []byte{0x81, 0x00}},
+		{name: "nil validator", v: nil, data: []byte{0x03, 0x00}},
+		{name: "ping.fragmented", v: server, data: []byte{0x09, 0x80, 0, 0, 0, 0}, wantErr: ErrControlFrameFragmented},
+		{name: "ping.too.large", v: server, data: []byte{0x89, 0xFE, 0x00, 0x7E, 0, 0, 0, 0}, wantErr: ErrControlFrameTooLarge},
+		{name: "opcode.3", v: server, data: []byte{0x83, 0x80, 0, 0, 0, 0}, wantErr: ErrReservedOpcode},
+		{name: "opcode.0xB", v: server, data: []byte{0x8B, 0x80, 0, 0, 0, 0}, wantErr: ErrReservedOpcode},
+		{name: "rsv1", v: server, data: []byte{0xC1, 0x80, 0, 0, 0, 0}, wantErr: ErrRsvNotNegotiated},
+		{name: "rsv1.deflate", v: deflate, data: []byte{0xC1, 0x80, 0, 0, 0, 0}},
+		{name: "rsv2.deflate", v: deflate, data: []byte{0xA1, 0x80, 0, 0, 0, 0}, wantErr: ErrRsvNotNegotiated},
+		{name: "rsv3", v: deflate, data: []byte{0x91, 0x80, 0, 0, 0, 0}, wantErr: ErrRsvNotNegotiated},
+		{name: "server.no.mask", v: server, data: []byte{0x81, 0x00}, wantErr: ErrMaskRequired},
+		{name: "client.mask", v: client, data: []byte{0x81, 0x80, 0, 0, 0, 0}, wantErr: ErrMaskNotAllowed},
+		{name: "length.msb", v: client, data: []byte{0x82, 0x7F, 0x80, 0, 0, 0, 0, 0, 0, 0}, wantErr: ErrPayloadLengthMSB},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var headArray [enum.MaxFrameHeaderSize]byte
+			_, _, err := tt.v.ReadHeader(bytes.NewReader(tt.data), &headArray)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReadHeader() error = %v, want %v", err, tt.wantErr)
+			}
+
+			var pe *ProtocolError
+			if err != nil && (!errors.As(err, &pe) || pe.StatusCode() != closecode.ProtocolError) {
+				t.Fatalf("error %v should be a ProtocolError with 1002", err)
+			}
+		})
+	}
+}
+
+func Test_Validator_ReadFrame(t *testing.T) {
+	t.Run("ReadFrameV2.ok", func(t *testing.T) {
+		buf := make([]byte, 512)
+		r := fixedreader.NewFixedReader(bytes.NewReader(haveMaskData), &buf)
+		var headArray [enum.MaxFrameHeaderSize]byte
+		v := &Validator{NeedMask: true}
+		f, err := v.ReadFrameV2(r, &headArray)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(*f.Payload) != "Hello" || f.Opcode != opcode.Text {
+			t.Fatalf("payload:%s", *f.Payload)
+		}
+	})
+
+	t.Run("ReadFrameFromReader.mask", func(t *testing.T) {
+		var headArray [enum.MaxFrameHeaderSize]byte
+		var buf []byte
+		v := &Validator{}
+		_, err := v.ReadFrameFromReader(bytes.NewReader(haveMaskData), &headArray, &buf)
+		if err != ErrMaskNotAllowed {
+			t.Fatalf("got %v, want %v", err, ErrMaskNotAllowed)
+		}
+	})
+}
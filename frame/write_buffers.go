@@ -0,0 +1,137 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package frame
+
+import (
+	"io"
+	"net"
+
+	"github.com/antlabs/wsutil/bytespool"
+	"github.com/antlabs/wsutil/enum"
+	"github.com/antlabs/wsutil/mask"
+	"github.com/antlabs/wsutil/opcode"
+)
+
+// 客户端分块mask时默认的块大小, 必须是4的倍数, 这样每块都可以直接使用同一个mask key
+const DefaultMaskChunkSize = 1024 * 16
+
+// 批量写的一个frame
+type BufferFrame struct {
+	Payload []byte
+	Fin     bool
+	Rsv1    bool
+	Opcode  opcode.Opcode
+}
+
+// 写一个frame
+// 服务端(isMask为false)使用net.Buffers把header和payload一起写出去, 不拷贝payload,
+// w是*net.TCPConn这类实现了writev的连接时只有一次系统调用
+// 客户端(isMask为true)不能修改payload, 使用WriteFrameMaskChunked分块mask
+func WriteFrameBuffers(w io.Writer, payload []byte, fin bool, rsv1 bool, isMask bool, code opcode.Opcode, maskValue uint32) (err error) {
+	if isMask {
+		return WriteFrameMaskChunked(w, payload, fin, rsv1, code, maskValue, DefaultMaskChunkSize)
+	}
+
+	var head [enum.MaxFrameHeaderSize]byte
+	n, err := WriteHeader(head[:], fin, rsv1, false, false, code, len(payload), false, 0)
+	if err != nil {
+		return err
+	}
+
+	if len(payload) == 0 {
+		_, err = w.Write(head[:n])
+		return err
+	}
+
+	bufs := net.Buffers{head[:n], payload}
+	_, err = bufs.WriteTo(w)
+	return err
+}
+
+// 批量写多个服务端的frame(没有mask), 所有frame的header和payload使用一个net.Buffers写出去
+// 适合一次要发很多小消息的场景, 比如合并之后的推送
+func WriteFramesBuffers(w io.Writer, frames []BufferFrame) (err error) {
+	if len(frames) == 0 {
+		return nil
+	}
+
+	// 所有的header放在一块内存里面
+	heads := bytespool.GetBytes(len(frames) * enum.MaxFrameHeaderSize)
+	defer bytespool.PutBytes(heads)
+
+	bufs := make(net.Buffers, 0, len(frames)*2)
+	pos := 0
+	for i := range frames {
+		f := &frames[i]
+		head := (*heads)[pos : pos+enum.MaxFrameHeaderSize]
+		n, err := WriteHeader(head, f.Fin, f.Rsv1, false, false, f.Opcode, len(f.Payload), false, 0)
+		if err != nil {
+			return err
+		}
+
+		bufs = append(bufs, head[:n])
+		if len(f.Payload) > 0 {
+			bufs = append(bufs, f.Payload)
+		}
+		pos += n
+	}
+
+	_, err = bufs.WriteTo(w)
+	return err
+}
+
+// 客户端写一个frame, payload不会被修改
+// 每次拷贝chunkSize个字节到池里面的内存, mask之后写出去, 不需要和payload一样大的内存
+// chunkSize会向下取整到4的倍数, 小于等于0时使用DefaultMaskChunkSize
+func WriteFrameMaskChunked(w io.Writer, payload []byte, fin bool, rsv1 bool, code opcode.Opcode, maskValue uint32, chunkSize int) (err error) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultMaskChunkSize
+	}
+	chunkSize &^= 3
+	if chunkSize == 0 {
+		chunkSize = 4
+	}
+
+	size := len(payload)
+	if size > chunkSize {
+		size = chunkSize
+	}
+	buf := bytespool.GetBytes(size + enum.MaxFrameHeaderSize)
+	defer bytespool.PutBytes(buf)
+
+	// 第一块和header一起写
+	n, err := WriteHeader(*buf, fin, rsv1, false, false, code, len(payload), true, maskValue)
+	if err != nil {
+		return err
+	}
+
+	for first := true; first || len(payload) > 0; first = false {
+		chunk := payload
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+		payload = payload[len(chunk):]
+
+		start := 0
+		if first {
+			start = n
+		}
+		// chunkSize是4的倍数, 每块的开头都对齐到mask key的第一个字节
+		mask.MaskTo((*buf)[start:], chunk, maskValue)
+		if _, err = w.Write((*buf)[:start+len(chunk)]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
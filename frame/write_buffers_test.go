@@ -0,0 +1,133 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package frame
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/antlabs/wsutil/fixedwriter"
+	"github.com/antlabs/wsutil/opcode"
+)
+
+func Test_WriteFrameBuffers(t *testing.T) {
+	for _, size := range []int{0, 1, 125, 126, 1000, 70000} {
+		payload := bytes.Repeat([]byte("0123456789"), size/10+1)[:size]
+		orig := append([]byte(nil), payload...)
+
+		for _, isMask := range []bool{false, true} {
+			var want bytes.Buffer
+			if err := WriteFrameToBytes(&want, payload, true, true, isMask, opcode.Binary, 0x12345678); err != nil {
+				t.Fatal(err)
+			}
+
+			var got bytes.Buffer
+			if err := WriteFrameBuffers(&got, payload, true, true, isMask, opcode.Binary, 0x12345678); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), want.Bytes()) {
+				t.Fatalf("size:%d, mask:%v, output mismatch", size, isMask)
+			}
+
+			// 不同的块大小, 结果一样
+			for _, chunkSize := range []int{-1, 1, 5, 1000} {
+				got.Reset()
+				if err := WriteFrameMaskChunked(&got, payload, true, true, opcode.Binary, 0x12345678, chunkSize); err != nil {
+					t.Fatal(err)
+				}
+				want.Reset()
+				WriteFrameToBytes(&want, payload, true, true, true, opcode.Binary, 0x12345678)
+				if !bytes.Equal(got.Bytes(), want.Bytes()) {
+					t.Fatalf("size:%d, chunk:%d, output mismatch", size, chunkSize)
+				}
+			}
+
+			if !bytes.Equal(payload, orig) {
+				t.Fatalf("size:%d, payload was modified", size)
+			}
+		}
+	}
+}
+
+func Test_WriteFramesBuffers(t *testing.T) {
+	frames := []BufferFrame{
+		{Payload: []byte("hello"), Fin: false, Opcode: opcode.Text},
+		{Payload: []byte(" world"), Fin: true, Opcode: opcode.Continuation},
+		{Payload: nil, Fin: true, Opcode: opcode.Ping},
+		{Payload: bytes.Repeat([]byte("a"), 70000), Fin: true, Rsv1: true, Opcode: opcode.Binary},
+	}
+
+	var want bytes.Buffer
+	for _, f := range frames {
+		if err := WriteFrameToBytes(&want, f.Payload, f.Fin, f.Rsv1, false, f.Opcode, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 使用tcp连接, 走writev
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+
+	done := make(chan []byte)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			done <- nil
+			return
+		}
+		all, _ := io.ReadAll(c)
+		done <- all
+	}()
+
+	c, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFramesBuffers(c, frames); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	if got := <-done; !bytes.Equal(got, want.Bytes()) {
+		t.Fatalf("got %d bytes, want %d bytes", len(got), want.Len())
+	}
+
+	if err := WriteFramesBuffers(io.Discard, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Benchmark_WriteFrame_Copy(b *testing.B) {
+	payload := bytes.Repeat([]byte("a"), 1024*32)
+	var fw fixedwriter.FixedWriter
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		WriteFrame(&fw, io.Discard, payload, true, false, false, opcode.Binary, 0)
+	}
+}
+
+func Benchmark_WriteFrame_Buffers(b *testing.B) {
+	payload := bytes.Repeat([]byte("a"), 1024*32)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		WriteFrameBuffers(io.Discard, payload, true, false, false, opcode.Binary, 0)
+	}
+}
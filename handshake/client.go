@@ -0,0 +1,47 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package handshake
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// 生成客户端的升级请求, 追加到dst后面
+// header里面是用户自定义的header, 比如Origin, Sec-WebSocket-Protocol, Sec-WebSocket-Extensions
+// https://datatracker.ietf.org/doc/html/rfc6455#section-4.1
+func AppendRequest(dst []byte, u *url.URL, key string, header http.Header) []byte {
+	dst = append(dst, "GET "...)
+	dst = append(dst, u.RequestURI()...)
+	dst = append(dst, " HTTP/1.1\r\n"...)
+	dst = append(dst, "Host: "...)
+	dst = append(dst, u.Host...)
+	dst = append(dst, "\r\n"...)
+	dst = append(dst, "Upgrade: websocket\r\n"...)
+	dst = append(dst, "Connection: Upgrade\r\n"...)
+	dst = append(dst, "Sec-WebSocket-Key: "...)
+	dst = append(dst, key...)
+	dst = append(dst, "\r\n"...)
+	dst = append(dst, "Sec-WebSocket-Version: 13\r\n"...)
+
+	for k, vs := range header {
+		for _, v := range vs {
+			dst = append(dst, k...)
+			dst = append(dst, ": "...)
+			dst = append(dst, v...)
+			dst = append(dst, "\r\n"...)
+		}
+	}
+	return append(dst, "\r\n"...)
+}
@@ -0,0 +1,85 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handshake
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/antlabs/wsutil/bytespool"
+	"github.com/antlabs/wsutil/enum"
+	"github.com/antlabs/wsutil/fixedreader"
+)
+
+// go test -fuzz=FuzzReadResponse ./handshake
+// testdata/fuzz下面是真实的客户端和服务端在本机抓的包, 响应后面跟着服务端的frame, 用testdata/capture生成
+// 线性模式和环形模式结果一样, 成功的时候响应后面的数据一个字节都不能少
+func FuzzReadResponse(f *testing.F) {
+	f.Add(testKey, AppendResponse(nil, testKey, "", "permessage-deflate"))
+	f.Add(testKey, []byte("HTTP/1.1 101 Switching Protocols\r\n\r\n"))
+
+	f.Fuzz(func(t *testing.T, key string, data []byte) {
+		var errs [2]error
+		for i, newReader := range []func(r *bytes.Reader, buf *[]byte) *fixedreader.FixedReader{
+			func(r *bytes.Reader, buf *[]byte) *fixedreader.FixedReader { return fixedreader.NewFixedReader(r, buf) },
+			func(r *bytes.Reader, buf *[]byte) *fixedreader.FixedReader { return fixedreader.NewRingReader(r, buf) },
+		} {
+			buf := bytespool.GetBytes(1024 + enum.MaxFrameHeaderSize)
+			r := newReader(bytes.NewReader(data), buf)
+			_, errs[i] = ReadResponse(r, key, nil, []string{"permessage-deflate"})
+			if errs[i] == nil {
+				var rest bytes.Buffer
+				r.WriteTo(&rest)
+				want := data[bytes.Index(data, crlfcrlf)+len(crlfcrlf):]
+				if !bytes.Equal(rest.Bytes(), want) {
+					t.Fatalf("reader %d: %d bytes after response, want %d", i, rest.Len(), len(want))
+				}
+			}
+			r.Release()
+			bytespool.PutBytes(buf)
+		}
+
+		if (errs[0] == nil) != (errs[1] == nil) {
+			t.Fatalf("linear err = %v, ring err = %v", errs[0], errs[1])
+		}
+	})
+}
+
+// go test -fuzz=FuzzCheckRequest ./handshake
+// CheckRequest通过的请求, 服务端生成的响应客户端一定能通过检查
+func FuzzCheckRequest(f *testing.F) {
+	f.Add([]byte("GET /chat HTTP/1.1\r\nHost: example.com\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + testKey + "\r\nSec-WebSocket-Version: 13\r\n\r\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+		if err != nil {
+			return
+		}
+
+		key, err := CheckRequest(req)
+		if err != nil {
+			return
+		}
+
+		buf := make([]byte, 1024)
+		r := fixedreader.NewFixedReader(bytes.NewReader(AppendResponse(nil, key, "", "")), &buf)
+		if _, err = ReadResponse(r, key, nil, nil); err != nil {
+			t.Fatalf("key %q: %v", key, err)
+		}
+	})
+}
@@ -0,0 +1,89 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package handshake
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// https://datatracker.ietf.org/doc/html/rfc6455#section-1.3
+const guid = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// 16字节的随机数, base64之后是24个字节
+const keySize = 24
+
+// 生成客户端的Sec-WebSocket-Key
+func GenSecWebSocketKey() string {
+	var p [16]byte
+	if _, err := io.ReadFull(rand.Reader, p[:]); err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(p[:])
+}
+
+// 计算Sec-WebSocket-Accept, 结果追加到dst后面
+func AppendSecWebSocketAccept(dst []byte, key string) []byte {
+	// key一般是24个字节, 加上guid也放得下, 不用分配内存
+	var buf [keySize + len(guid)]byte
+	sum := sha1.Sum(append(append(buf[:0], key...), guid...))
+
+	n := len(dst)
+	size := base64.StdEncoding.EncodedLen(len(sum))
+	for i := 0; i < size; i++ {
+		dst = append(dst, 0)
+	}
+	base64.StdEncoding.Encode(dst[n:], sum[:])
+	return dst
+}
+
+// 计算Sec-WebSocket-Accept
+func SecWebSocketAccept(key string) string {
+	var buf [28]byte
+	return string(AppendSecWebSocketAccept(buf[:0], key))
+}
+
+// 检查Sec-WebSocket-Key, 必须是16字节随机数的base64
+// https://datatracker.ietf.org/doc/html/rfc6455#section-4.1
+func checkSecWebSocketKey(key string) bool {
+	if len(key) != keySize {
+		return false
+	}
+
+	var buf [18]byte
+	n, err := base64.StdEncoding.Decode(buf[:], []byte(key))
+	return err == nil && n == 16
+}
+
+// header里面是否有token, 不区分大小写, 多个值用逗号分隔
+// 比如 Connection: keep-alive, Upgrade
+func headerContainsToken(h http.Header, name string, token string) bool {
+	for _, v := range h[name] {
+		for {
+			var t string
+			t, v, _ = strings.Cut(v, ",")
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+			if v == "" {
+				break
+			}
+		}
+	}
+	return false
+}
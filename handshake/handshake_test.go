@@ -0,0 +1,136 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package handshake
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/antlabs/wsutil/bytespool"
+)
+
+// rfc6455 1.3 里面的例子
+const (
+	testKey    = "dGhlIHNhbXBsZSBub25jZQ=="
+	testAccept = "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="
+)
+
+func Test_SecWebSocketAccept(t *testing.T) {
+	if got := SecWebSocketAccept(testKey); got != testAccept {
+		t.Fatalf("got %s, want %s", got, testAccept)
+	}
+
+	key := GenSecWebSocketKey()
+	if !checkSecWebSocketKey(key) {
+		t.Fatalf("GenSecWebSocketKey() = %s, is invalid", key)
+	}
+}
+
+func newTestRequest() *http.Request {
+	r, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/chat", nil)
+	r.Header.Set("Connection", "keep-alive, Upgrade")
+	r.Header.Set("Upgrade", "WebSocket")
+	r.Header.Set("Sec-WebSocket-Version", "13")
+	r.Header.Set("Sec-WebSocket-Key", testKey)
+	return r
+}
+
+func Test_CheckRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(r *http.Request)
+		wantErr error
+	}{
+		{name: "ok", modify: func(r *http.Request) {}},
+		{name: "method", modify: func(r *http.Request) { r.Method = http.MethodPost }, wantErr: ErrMethod},
+		{name: "connection", modify: func(r *http.Request) { r.Header.Set("Connection", "keep-alive") }, wantErr: ErrConnection},
+		{name: "upgrade", modify: func(r *http.Request) { r.Header.Set("Upgrade", "h2c") }, wantErr: ErrUpgrade},
+		{name: "version", modify: func(r *http.Request) { r.Header.Set("Sec-WebSocket-Version", "8") }, wantErr: ErrVersion},
+		{name: "key.empty", modify: func(r *http.Request) { r.Header.Del("Sec-WebSocket-Key") }, wantErr: ErrSecWebSocketKey},
+		{name: "key.short", modify: func(r *http.Request) { r.Header.Set("Sec-WebSocket-Key", "aGVsbG8=") }, wantErr: ErrSecWebSocketKey},
+		{name: "key.not.base64", modify: func(r *http.Request) { r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZ!==") }, wantErr: ErrSecWebSocketKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRequest()
+			tt.modify(r)
+			key, err := CheckRequest(r)
+			if err != tt.wantErr {
+				t.Fatalf("CheckRequest() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && key != testKey {
+				t.Fatalf("CheckRequest() key = %s, want %s", key, testKey)
+			}
+		})
+	}
+}
+
+func Test_AppendResponse(t *testing.T) {
+	buf := bytespool.GetUpgradeRespBytes()
+	defer bytespool.PutUpgradeRespBytes(buf)
+
+	rsp := AppendResponse((*buf)[:0], testKey, "chat", "permessage-deflate; server_no_context_takeover")
+	r, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(rsp)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status code = %d", r.StatusCode)
+	}
+	for k, v := range map[string]string{
+		"Upgrade":                  "websocket",
+		"Connection":               "Upgrade",
+		"Sec-Websocket-Accept":     testAccept,
+		"Sec-Websocket-Protocol":   "chat",
+		"Sec-Websocket-Extensions": "permessage-deflate; server_no_context_takeover",
+	} {
+		if got := r.Header.Get(k); got != v {
+			t.Errorf("%s = %s, want %s", k, got, v)
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		AppendResponse((*buf)[:0], testKey, "chat", "")
+	})
+	if allocs != 0 {
+		t.Fatalf("AppendResponse allocs = %v, want 0", allocs)
+	}
+}
+
+func Test_AppendRequest(t *testing.T) {
+	u, _ := url.Parse("ws://127.0.0.1:8080/chat?room=1")
+	req := AppendRequest(nil, u, testKey, http.Header{"Origin": {"http://127.0.0.1"}})
+
+	r, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(req)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Host != "127.0.0.1:8080" || r.RequestURI != "/chat?room=1" {
+		t.Fatalf("host = %s, uri = %s", r.Host, r.RequestURI)
+	}
+	if r.Header.Get("Origin") != "http://127.0.0.1" {
+		t.Fatalf("Origin = %s", r.Header.Get("Origin"))
+	}
+
+	// 服务端可以直接通过检查
+	if _, err := CheckRequest(r); err != nil {
+		t.Fatal(err)
+	}
+}
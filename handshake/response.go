@@ -0,0 +1,162 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package handshake
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/antlabs/wsutil/fixedreader"
+)
+
+var (
+	ErrResponseTooLarge  = errors.New("handshake: response header is larger than the read buffer")
+	ErrMalformedResponse = errors.New("handshake: malformed response")
+	ErrStatusCode        = errors.New("handshake: unexpected status code")
+	ErrSubprotocol       = errors.New("handshake: server selected a subprotocol that was not offered")
+	ErrExtension         = errors.New("handshake: server selected an extension that was not offered")
+)
+
+var crlfcrlf = []byte("\r\n\r\n")
+
+// 服务端的升级响应
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	// 服务端选中的子协议
+	Subprotocol string
+	// 服务端返回的Sec-WebSocket-Extensions
+	Extensions string
+}
+
+// ReadResponse 从r里面读取服务端的升级响应, 并且检查
+// protocols是客户端提供的子协议, extensions是客户端提供的扩展名(不带参数)
+//
+// 返回之后, r正好指向响应后面的第一个字节, 也就是第一个frame的开始
+// 和header一起读上来的frame数据不会丢, 可以直接调用frame.ReadFrameV2继续读
+// header的大小不能超过r的缓存区, 不然返回ErrResponseTooLarge
+func ReadResponse(r *fixedreader.FixedReader, key string, protocols []string, extensions []string) (rsp Response, err error) {
+	head, err := readHead(r)
+	if err != nil {
+		return rsp, err
+	}
+
+	if err = parseHead(head, &rsp); err != nil {
+		return rsp, err
+	}
+
+	if rsp.StatusCode != http.StatusSwitchingProtocols {
+		return rsp, fmt.Errorf("%w: %d", ErrStatusCode, rsp.StatusCode)
+	}
+
+	if !headerContainsToken(rsp.Header, "Upgrade", "websocket") {
+		return rsp, ErrUpgrade
+	}
+
+	if !headerContainsToken(rsp.Header, "Connection", "upgrade") {
+		return rsp, ErrConnection
+	}
+
+	if rsp.Header.Get("Sec-Websocket-Accept") != SecWebSocketAccept(key) {
+		return rsp, ErrSecWebSocketAccept
+	}
+
+	if rsp.Subprotocol, err = CheckSubprotocol(rsp.Header, protocols); err != nil {
+		return rsp, err
+	}
+
+	rsp.Extensions = strings.Join(rsp.Header["Sec-Websocket-Extensions"], ", ")
+	for _, ext := range strings.Split(rsp.Extensions, ",") {
+		name, _, _ := strings.Cut(ext, ";")
+		if name = strings.TrimSpace(name); name != "" && !contains(extensions, name) {
+			return rsp, ErrExtension
+		}
+	}
+
+	return rsp, nil
+}
+
+// 读到\r\n\r\n为止, 返回的head包含最后一行的\r\n
+// 只用Peek和Discard, 线性模式和环形模式的FixedReader都可以用
+func readHead(r *fixedreader.FixedReader) (head []byte, err error) {
+	// 已经找过的字节数, 相对r.R
+	scanned := 0
+	for {
+		buf, _ := r.Peek(r.Buffered())
+		if i := bytes.Index(buf[scanned:], crlfcrlf); i >= 0 {
+			i += scanned
+			head = buf[:i+2]
+			r.Discard(i + len(crlfcrlf))
+			return head, nil
+		}
+
+		// 下次从末尾3个字节开始找, \r\n\r\n可能被切断
+		if scanned = len(buf) - (len(crlfcrlf) - 1); scanned < 0 {
+			scanned = 0
+		}
+
+		if r.Buffered() == r.Len() {
+			return nil, ErrResponseTooLarge
+		}
+
+		// 至少再读一个字节
+		if _, err = r.Peek(r.Buffered() + 1); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// 解析状态行和header
+func parseHead(head []byte, rsp *Response) error {
+	line, head, _ := bytes.Cut(head, []byte("\r\n"))
+
+	// HTTP/1.1 101 Switching Protocols
+	proto, status, ok := bytes.Cut(line, []byte(" "))
+	if !ok || !bytes.HasPrefix(proto, []byte("HTTP/1.")) || len(status) < 3 {
+		return ErrMalformedResponse
+	}
+
+	code, err := strconv.Atoi(string(status[:3]))
+	if err != nil || len(status) > 3 && status[3] != ' ' {
+		return ErrMalformedResponse
+	}
+
+	rsp.StatusCode = code
+	rsp.Header = make(http.Header)
+	for len(head) > 0 {
+		line, head, _ = bytes.Cut(head, []byte("\r\n"))
+		k, v, ok := bytes.Cut(line, []byte(":"))
+		// 不支持obs-fold
+		if !ok || len(k) == 0 || k[0] == ' ' || k[0] == '\t' {
+			return ErrMalformedResponse
+		}
+
+		rsp.Header.Add(textproto.CanonicalMIMEHeaderKey(string(k)), string(bytes.TrimSpace(v)))
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package handshake
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/antlabs/wsutil/bytespool"
+	"github.com/antlabs/wsutil/enum"
+	"github.com/antlabs/wsutil/fixedreader"
+	"github.com/antlabs/wsutil/frame"
+	"github.com/antlabs/wsutil/opcode"
+)
+
+func Test_ReadResponse(t *testing.T) {
+	t.Run("then.read.frame", func(t *testing.T) {
+		var out bytes.Buffer
+		out.Write(AppendResponse(nil, testKey, "chat", "permessage-deflate; server_no_context_takeover"))
+		// 和响应一起到达的frame
+		if err := frame.WriteFrameToBytes(&out, []byte("hello"), true, false, false, opcode.Text, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := frame.WriteFrameToBytes(&out, []byte("world"), true, false, false, opcode.Binary, 0); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range []string{"all", "one.byte", "ring", "ring.one.byte"} {
+			rd := bytes.NewReader(out.Bytes())
+			r := fixedreader.NewFixedReader(rd, bytespool.GetBytes(1024+enum.MaxFrameHeaderSize))
+			if strings.HasPrefix(name, "ring") {
+				r = fixedreader.NewRingReader(rd, bytespool.GetBytes(1024+enum.MaxFrameHeaderSize))
+			}
+			if strings.HasSuffix(name, "one.byte") {
+				r.ResetReader(iotest.OneByteReader(rd))
+			}
+
+			rsp, err := ReadResponse(r, testKey, []string{"superchat", "chat"}, []string{"permessage-deflate"})
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if rsp.Subprotocol != "chat" || rsp.Extensions != "permessage-deflate; server_no_context_takeover" {
+				t.Fatalf("%s: %#v", name, rsp)
+			}
+
+			var headArray [enum.MaxFrameHeaderSize]byte
+			for _, want := range []string{"hello", "world"} {
+				f, err := frame.ReadFrameV2(r, &headArray)
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				if string(*f.Payload) != want {
+					t.Fatalf("%s: got %s, want %s", name, *f.Payload, want)
+				}
+			}
+		}
+	})
+
+	tests := []struct {
+		name    string
+		rsp     string
+		wantErr error
+	}{
+		{name: "status", rsp: "HTTP/1.1 403 Forbidden\r\nContent-Length: 0\r\n\r\n", wantErr: ErrStatusCode},
+		{name: "malformed", rsp: "HTTP/1.1 101Switching Protocols\r\n\r\n", wantErr: ErrMalformedResponse},
+		{name: "malformed.header", rsp: "HTTP/1.1 101 Switching Protocols\r\nUpgrade websocket\r\n\r\n", wantErr: ErrMalformedResponse},
+		{name: "upgrade", rsp: "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\n\r\n", wantErr: ErrUpgrade},
+		{name: "connection", rsp: "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n\r\n", wantErr: ErrConnection},
+		{name: "accept", rsp: "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: xx\r\n\r\n", wantErr: ErrSecWebSocketAccept},
+		{name: "subprotocol", rsp: string(AppendResponse(nil, testKey, "mqtt", "")), wantErr: ErrSubprotocol},
+		{name: "extension", rsp: string(AppendResponse(nil, testKey, "", "x-webkit-deflate-frame")), wantErr: ErrExtension},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := make([]byte, 256)
+			r := fixedreader.NewFixedReader(bytes.NewReader([]byte(tt.rsp)), &buf)
+			_, err := ReadResponse(r, testKey, []string{"chat"}, []string{"permessage-deflate"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReadResponse() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("too.large", func(t *testing.T) {
+		rsp := AppendResponse(nil, testKey, "", "")
+		buf := make([]byte, len(rsp)-1)
+		r := fixedreader.NewFixedReader(bytes.NewReader(rsp), &buf)
+		if _, err := ReadResponse(r, testKey, nil, nil); err != ErrResponseTooLarge {
+			t.Fatalf("got %v, want %v", err, ErrResponseTooLarge)
+		}
+	})
+}
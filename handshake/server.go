@@ -0,0 +1,88 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package handshake
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/antlabs/wsutil/bytespool"
+)
+
+var (
+	ErrMethod             = errors.New("handshake: method is not GET")
+	ErrConnection         = errors.New("handshake: Connection header does not contain upgrade")
+	ErrUpgrade            = errors.New("handshake: Upgrade header is not websocket")
+	ErrVersion            = errors.New("handshake: Sec-WebSocket-Version is not 13")
+	ErrSecWebSocketKey    = errors.New("handshake: invalid Sec-WebSocket-Key")
+	ErrSecWebSocketAccept = errors.New("handshake: invalid Sec-WebSocket-Accept")
+)
+
+// 检查客户端的升级请求, 返回Sec-WebSocket-Key
+// 返回ErrVersion时, 应该响应426, 并且带上Sec-WebSocket-Version: 13
+// https://datatracker.ietf.org/doc/html/rfc6455#section-4.2.1
+func CheckRequest(r *http.Request) (key string, err error) {
+	if r.Method != http.MethodGet {
+		return "", ErrMethod
+	}
+
+	if !headerContainsToken(r.Header, "Connection", "upgrade") {
+		return "", ErrConnection
+	}
+
+	if !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		return "", ErrUpgrade
+	}
+
+	if r.Header.Get("Sec-Websocket-Version") != "13" {
+		return "", ErrVersion
+	}
+
+	key = r.Header.Get("Sec-Websocket-Key")
+	if !checkSecWebSocketKey(key) {
+		return "", ErrSecWebSocketKey
+	}
+	return key, nil
+}
+
+// 生成101响应, 追加到dst后面
+// dst一般使用bytespool.GetUpgradeRespBytes()拿到的内存, 常见的响应不会超过256字节, 所以不会分配内存
+// subprotocol和extensions为空时, 不会写对应的header
+func AppendResponse(dst []byte, key string, subprotocol string, extensions string) []byte {
+	dst = append(dst, "HTTP/1.1 101 Switching Protocols\r\n"...)
+	dst = append(dst, "Upgrade: websocket\r\n"...)
+	dst = append(dst, "Connection: Upgrade\r\n"...)
+	dst = append(dst, "Sec-WebSocket-Accept: "...)
+	dst = AppendSecWebSocketAccept(dst, key)
+	dst = append(dst, "\r\n"...)
+
+	dst = AppendSubprotocolHeader(dst, subprotocol)
+
+	if extensions != "" {
+		dst = append(dst, "Sec-WebSocket-Extensions: "...)
+		dst = append(dst, extensions...)
+		dst = append(dst, "\r\n"...)
+	}
+	return append(dst, "\r\n"...)
+}
+
+// 把101响应写到w里面, 一般是hijack之后的net.Conn
+func WriteResponse(w io.Writer, key string, subprotocol string, extensions string) error {
+	buf := bytespool.GetUpgradeRespBytes()
+	rsp := AppendResponse((*buf)[:0], key, subprotocol, extensions)
+	_, err := w.Write(rsp)
+	bytespool.PutUpgradeRespBytes(buf)
+	return err
+}
@@ -0,0 +1,105 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package handshake
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/antlabs/wsutil/httptoken"
+)
+
+// 解析客户端的Sec-WebSocket-Protocol, 多个值用逗号分隔, 也可能是多个header
+// 不是token的值会被忽略
+// https://datatracker.ietf.org/doc/html/rfc6455#section-11.3.4
+func ParseSubprotocols(h http.Header) (protocols []string) {
+	for _, s := range h["Sec-Websocket-Protocol"] {
+		for s != "" {
+			var t string
+			t, s = httptoken.NextToken(httptoken.SkipSpace(s))
+			s = httptoken.SkipSpace(s)
+			if t != "" && (s == "" || s[0] == ',') {
+				protocols = append(protocols, t)
+			}
+
+			// 跳到下一个逗号后面
+			if i := strings.IndexByte(s, ','); i >= 0 {
+				s = s[i+1:]
+			} else {
+				s = ""
+			}
+		}
+	}
+	return protocols
+}
+
+// 服务端选择子协议, supported是服务端支持的子协议, 按优先级从高到低排列
+// 返回supported里面第一个客户端也提供了的子协议, 没有就返回空字符串
+func SelectSubprotocol(offered []string, supported []string) string {
+	for _, s := range supported {
+		if contains(offered, s) {
+			return s
+		}
+	}
+	return ""
+}
+
+// 同SelectSubprotocol, 使用回调选择子协议
+// 回调返回的值不在offered里面时, 返回空字符串, 不会把客户端没有提供的子协议发出去
+func SelectSubprotocolFunc(offered []string, selector func(offered []string) string) string {
+	if len(offered) == 0 {
+		return ""
+	}
+
+	if s := selector(offered); contains(offered, s) {
+		return s
+	}
+	return ""
+}
+
+// 生成Sec-WebSocket-Protocol响应头, 追加到dst后面
+// protocol为空时不会写
+func AppendSubprotocolHeader(dst []byte, protocol string) []byte {
+	if protocol == "" {
+		return dst
+	}
+	dst = append(dst, "Sec-WebSocket-Protocol: "...)
+	dst = append(dst, protocol...)
+	return append(dst, "\r\n"...)
+}
+
+// 客户端检查服务端选中的子协议, offered是客户端提供的子协议
+// 服务端可以不选, 这时候返回空字符串, 选了就必须是offered里面的一个
+// https://datatracker.ietf.org/doc/html/rfc6455#section-4.1
+func CheckSubprotocol(h http.Header, offered []string) (protocol string, err error) {
+	values := h["Sec-Websocket-Protocol"]
+	switch len(values) {
+	case 0:
+		return "", nil
+	case 1:
+	default:
+		// 只能选一个
+		return "", ErrSubprotocol
+	}
+
+	protocol = strings.TrimSpace(values[0])
+	if protocol == "" {
+		return "", nil
+	}
+
+	if !contains(offered, protocol) {
+		return "", ErrSubprotocol
+	}
+	return protocol, nil
+}
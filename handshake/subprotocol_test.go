@@ -0,0 +1,88 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package handshake
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func Test_ParseSubprotocols(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []string
+	}{
+		{name: "empty", values: nil, want: nil},
+		{name: "one", values: []string{"chat"}, want: []string{"chat"}},
+		{name: "list", values: []string{" chat , superchat,mqtt "}, want: []string{"chat", "superchat", "mqtt"}},
+		{name: "multi.header", values: []string{"chat", "v2.bookings.example.net"}, want: []string{"chat", "v2.bookings.example.net"}},
+		{name: "skip.invalid", values: []string{"chat, a b, , x/y, mqtt"}, want: []string{"chat", "mqtt"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{"Sec-Websocket-Protocol": tt.values}
+			if got := ParseSubprotocols(h); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ParseSubprotocols() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_SelectSubprotocol(t *testing.T) {
+	offered := []string{"chat", "superchat"}
+	if got := SelectSubprotocol(offered, []string{"mqtt", "superchat", "chat"}); got != "superchat" {
+		t.Fatalf("got %q, want superchat", got)
+	}
+	if got := SelectSubprotocol(offered, []string{"mqtt"}); got != "" {
+		t.Fatalf("got %q, want empty", got)
+	}
+
+	last := func(offered []string) string { return offered[len(offered)-1] }
+	if got := SelectSubprotocolFunc(offered, last); got != "superchat" {
+		t.Fatalf("got %q, want superchat", got)
+	}
+	if got := SelectSubprotocolFunc(nil, last); got != "" {
+		t.Fatalf("got %q, want empty", got)
+	}
+	if got := SelectSubprotocolFunc(offered, func([]string) string { return "mqtt" }); got != "" {
+		t.Fatalf("not offered, got %q", got)
+	}
+}
+
+func Test_CheckSubprotocol(t *testing.T) {
+	offered := []string{"chat", "superchat"}
+	tests := []struct {
+		name    string
+		values  []string
+		want    string
+		wantErr error
+	}{
+		{name: "none", values: nil},
+		{name: "ok", values: []string{"superchat"}, want: "superchat"},
+		{name: "not.offered", values: []string{"mqtt"}, wantErr: ErrSubprotocol},
+		{name: "more.than.one", values: []string{"chat", "superchat"}, wantErr: ErrSubprotocol},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CheckSubprotocol(http.Header{"Sec-Websocket-Protocol": tt.values}, offered)
+			if got != tt.want || err != tt.wantErr {
+				t.Fatalf("CheckSubprotocol() = %q, %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
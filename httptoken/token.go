@@ -2,20 +2,14 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package deflate
+// Package httptoken RFC 2616 token的解析, 从deflate/parser_ext.go挪过来的
+// Sec-WebSocket-Extensions和Sec-WebSocket-Protocol都会用到
+package httptoken
 
-import (
-	"net/http"
-	"strings"
-)
-
-type pair struct {
-	key string
-	val string
-}
+import "strings"
 
 // Token octets per RFC 2616.
-var isTokenOctet = [256]bool{
+var tokenOctet = [256]bool{
 	'!':  true,
 	'#':  true,
 	'$':  true,
@@ -95,9 +89,20 @@ var isTokenOctet = [256]bool{
 	'~':  true,
 }
 
-// skipSpace returns a slice of the string s with all leading RFC 2616 linear
+// IsTokenOctet reports whether b is a token octet per RFC 2616.
+func IsTokenOctet(b byte) bool {
+	return tokenOctet[b]
+}
+
+// IsToken reports whether s is a non-empty RFC 2616 token.
+func IsToken(s string) bool {
+	t, rest := NextToken(s)
+	return t != "" && rest == ""
+}
+
+// SkipSpace returns a slice of the string s with all leading RFC 2616 linear
 // whitespace removed.
-func skipSpace(s string) (rest string) {
+func SkipSpace(s string) (rest string) {
 	i := 0
 	for ; i < len(s); i++ {
 		if b := s[i]; b != ' ' && b != '\t' {
@@ -107,23 +112,23 @@ func skipSpace(s string) (rest string) {
 	return s[i:]
 }
 
-// nextToken returns the leading RFC 2616 token of s and the string following
+// NextToken returns the leading RFC 2616 token of s and the string following
 // the token.
-func nextToken(s string) (token, rest string) {
+func NextToken(s string) (token, rest string) {
 	i := 0
 	for ; i < len(s); i++ {
-		if !isTokenOctet[s[i]] {
+		if !tokenOctet[s[i]] {
 			break
 		}
 	}
 	return s[:i], s[i:]
 }
 
-// nextTokenOrQuoted returns the leading token or quoted string per RFC 2616
+// NextTokenOrQuoted returns the leading token or quoted string per RFC 2616
 // and the string following the token or quoted string.
-func nextTokenOrQuoted(s string) (value string, rest string) {
+func NextTokenOrQuoted(s string) (value string, rest string) {
 	if !strings.HasPrefix(s, "\"") {
-		return nextToken(s)
+		return NextToken(s)
 	}
 	s = s[1:]
 	for i := 0; i < len(s); i++ {
@@ -155,61 +160,3 @@ func nextTokenOrQuoted(s string) (value string, rest string) {
 	}
 	return "", ""
 }
-
-// parseExtensions parses WebSocket extensions from a header.
-func parseExtensions(header http.Header) (result []pair) {
-	// From RFC 6455:
-	//
-	//  Sec-WebSocket-Extensions = extension-list
-	//  extension-list = 1#extension
-	//  extension = extension-token *( ";" extension-param )
-	//  extension-token = registered-token
-	//  registered-token = token
-	//  extension-param = token [ "=" (token | quoted-string) ]
-	//     ;When using the quoted-string syntax variant, the value
-	//     ;after quoted-string unescaping MUST conform to the
-	//     ;'token' ABNF.
-
-headers:
-	for _, s := range header["Sec-Websocket-Extensions"] {
-		for {
-			var t string
-			t, s = nextToken(skipSpace(s))
-			if t == "" {
-				continue headers
-			}
-			// ext := map[string]string{"": t}
-			result = append(result, pair{key: t})
-			for {
-				s = skipSpace(s)
-				if !strings.HasPrefix(s, ";") {
-					break
-				}
-				var k string
-				k, s = nextToken(skipSpace(s[1:]))
-				if k == "" {
-					continue headers
-				}
-				s = skipSpace(s)
-				var v string
-				if strings.HasPrefix(s, "=") {
-					v, s = nextTokenOrQuoted(skipSpace(s[1:]))
-					s = skipSpace(s)
-				}
-				if s != "" && s[0] != ',' && s[0] != ';' {
-					continue headers
-				}
-				// ext[k] = v
-				result = append(result, pair{key: k, val: v})
-			}
-			if s != "" && s[0] != ',' {
-				continue headers
-			}
-			if s == "" {
-				continue headers
-			}
-			s = s[1:]
-		}
-	}
-	return result
-}
@@ -0,0 +1,35 @@
+// Copyright 2013 The Gorilla WebSocket Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httptoken
+
+import "testing"
+
+func Test_NextTokenOrQuoted(t *testing.T) {
+	tests := []struct {
+		in, value, rest string
+	}{
+		{in: "foo", value: "foo", rest: ""},
+		{in: "foo; bar", value: "foo", rest: "; bar"},
+		{in: `"foo", bar`, value: "foo", rest: ", bar"},
+		{in: `"f\"oo"`, value: `f"oo`, rest: ""},
+		{in: `"foo`, value: "", rest: ""},
+		{in: " foo", value: "", rest: " foo"},
+	}
+
+	for _, tt := range tests {
+		value, rest := NextTokenOrQuoted(tt.in)
+		if value != tt.value || rest != tt.rest {
+			t.Errorf("NextTokenOrQuoted(%q) = %q, %q, want %q, %q", tt.in, value, rest, tt.value, tt.rest)
+		}
+	}
+}
+
+func Test_IsToken(t *testing.T) {
+	for s, want := range map[string]bool{"chat": true, "v2.example.net": true, "": false, "a b": false, "x/y": false} {
+		if got := IsToken(s); got != want {
+			t.Errorf("IsToken(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
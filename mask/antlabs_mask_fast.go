@@ -13,152 +13,83 @@
 // limitations under the License.
 package mask
 
-import (
-	"reflect"
-	"unsafe"
-)
+import "unsafe"
 
+// 使用unsafe.SliceData和unsafe.Add访问payload, 指针一直指向payload的底层数组里面
+// 可以通过-race和-gcflags=all=-d=checkptr的检查
+//
 //go:nosplit
 func maskFast(payload []byte, key uint32) {
-	if len(payload) == 0 {
+	n := len(payload)
+	if n == 0 {
 		return
 	}
 
-	base := (*reflect.SliceHeader)(unsafe.Pointer(&payload)).Data
-	last := base + uintptr(len(payload))
-	if len(payload) >= 8 {
+	p := unsafe.Pointer(unsafe.SliceData(payload))
+	i := 0
+	if n >= 8 {
 		key64 := uint64(key)<<32 | uint64(key)
-
-		var v *uint64
-		for base+128 <= last {
-
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
+		for ; i+128 <= n; i += 128 {
+			*(*uint64)(unsafe.Add(p, i)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+8)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+16)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+24)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+32)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+40)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+48)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+56)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+64)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+72)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+80)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+88)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+96)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+104)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+112)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+120)) ^= key64
 		}
 
-		if base == last {
-			return
+		if i+64 <= n {
+			*(*uint64)(unsafe.Add(p, i)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+8)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+16)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+24)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+32)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+40)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+48)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+56)) ^= key64
+			i += 64
 		}
 
-		if base+64 <= last {
-
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
+		if i+32 <= n {
+			*(*uint64)(unsafe.Add(p, i)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+8)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+16)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+24)) ^= key64
+			i += 32
 		}
 
-		if base+32 <= last {
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
+		if i+16 <= n {
+			*(*uint64)(unsafe.Add(p, i)) ^= key64
+			*(*uint64)(unsafe.Add(p, i+8)) ^= key64
+			i += 16
 		}
 
-		if base+16 <= last {
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
+		if i+8 <= n {
+			*(*uint64)(unsafe.Add(p, i)) ^= key64
+			i += 8
 		}
 
-		if base+8 <= last {
-			v = (*uint64)(unsafe.Pointer(base))
-			*v ^= key64
-			base += 8
-		}
-
-		if base == last {
+		if i == n {
 			return
 		}
 	}
 
-	if base+4 <= last {
-		v := (*uint32)(unsafe.Pointer(base))
-		*v ^= key
-		base += 4
+	if i+4 <= n {
+		*(*uint32)(unsafe.Add(p, i)) ^= key
+		i += 4
 	}
 
-	if base == last {
-		return
-	}
-	if base < last {
-		maskSlow(payload[len(payload)-int(last-base):], key)
+	if i < n {
+		maskSlow(payload[i:], key)
 	}
 }
@@ -121,3 +121,47 @@ func Benchmark_Mask_Fast_1024(t *testing.B) {
 // 		maskBig(payload[:], key)
 // 	}
 // }
+
+// 先拷贝再mask
+func Benchmark_Mask_CopyMask_1024(t *testing.B) {
+	var payload, dst [1024]byte
+	for i := 0; i < len(payload); i++ {
+		payload[i] = byte(i)
+	}
+
+	t.ResetTimer()
+	for i := 0; i < t.N; i++ {
+		copy(dst[:], payload[:])
+		maskFast(dst[:], 0x12345678)
+	}
+}
+
+func Benchmark_Mask_MaskTo_1024(t *testing.B) {
+	var payload, dst [1024]byte
+	for i := 0; i < len(payload); i++ {
+		payload[i] = byte(i)
+	}
+
+	t.ResetTimer()
+	for i := 0; i < t.N; i++ {
+		maskToFast(dst[:], payload[:], 0x12345678)
+	}
+}
+
+func Benchmark_Mask_Asm_1024(t *testing.B) {
+	if maskAsm == nil {
+		t.Skip("没有汇编实现")
+	}
+	var payload [1024]byte
+	var maskValue [4]byte
+
+	for i := 0; i < len(payload); i++ {
+		payload[i] = byte(i)
+	}
+	newMask(maskValue[:])
+	key := binary.LittleEndian.Uint32(maskValue[:])
+	t.ResetTimer()
+	for i := 0; i < t.N; i++ {
+		maskAsm(payload[:], key)
+	}
+}
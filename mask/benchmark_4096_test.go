@@ -111,3 +111,21 @@ func Benchmark_Mask_Fast_4096(t *testing.B) {
 // 		maskBig(payload[:], key)
 // 	}
 // }
+
+func Benchmark_Mask_Asm_4096(t *testing.B) {
+	if maskAsm == nil {
+		t.Skip("没有汇编实现")
+	}
+	var payload [4096]byte
+	var maskValue [4]byte
+
+	for i := 0; i < len(payload); i++ {
+		payload[i] = byte(i)
+	}
+	newMask(maskValue[:])
+	key := binary.LittleEndian.Uint32(maskValue[:])
+	t.ResetTimer()
+	for i := 0; i < t.N; i++ {
+		maskAsm(payload[:], key)
+	}
+}
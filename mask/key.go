@@ -0,0 +1,31 @@
+// Copyright 2021-2023 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package mask
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+)
+
+// 客户端每个frame的mask key
+// https://datatracker.ietf.org/doc/html/rfc6455#section-5.3
+// 要求不能被预测, 所以使用crypto/rand, 不能用math/rand
+func NewKey() uint32 {
+	var p [4]byte
+	if _, err := io.ReadFull(rand.Reader, p[:]); err != nil {
+		panic(err)
+	}
+	return binary.LittleEndian.Uint32(p[:])
+}
@@ -24,8 +24,15 @@ func init() {
 	if b {
 		// 小端机器
 		Mask = maskFast
+		MaskTo = maskToFast
 	} else {
 		// 大端机器
 		Mask = maskSlow
+		MaskTo = maskToSlow
+	}
+
+	// amd64(SSE2/AVX2)和arm64(NEON)有汇编实现, 使用purego编译标签可以关掉
+	if maskAsm != nil {
+		Mask = maskAsm
 	}
 }
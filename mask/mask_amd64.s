@@ -0,0 +1,155 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !purego
+
+#include "textflag.h"
+
+// 寄存器: DI 数据的地址, CX 剩余的长度, AX key, X0 4个key
+// 前面处理的长度都是4的倍数, 尾巴从key的第一个字节开始
+
+// func maskSSE2(p *byte, n int, key uint32)
+TEXT ·maskSSE2(SB), NOSPLIT, $0-20
+	MOVQ p+0(FP), DI
+	MOVQ n+8(FP), CX
+	MOVL key+16(FP), AX
+	MOVQ AX, X0
+	PSHUFD $0, X0, X0
+
+sse2_loop64:
+	CMPQ CX, $64
+	JB   sse2_tail16
+	MOVOU (DI), X1
+	MOVOU 16(DI), X2
+	MOVOU 32(DI), X3
+	MOVOU 48(DI), X4
+	PXOR  X0, X1
+	PXOR  X0, X2
+	PXOR  X0, X3
+	PXOR  X0, X4
+	MOVOU X1, (DI)
+	MOVOU X2, 16(DI)
+	MOVOU X3, 32(DI)
+	MOVOU X4, 48(DI)
+	ADDQ  $64, DI
+	SUBQ  $64, CX
+	JMP   sse2_loop64
+
+sse2_tail16:
+	CMPQ CX, $16
+	JB   sse2_tail8
+	MOVOU (DI), X1
+	PXOR  X0, X1
+	MOVOU X1, (DI)
+	ADDQ  $16, DI
+	SUBQ  $16, CX
+	JMP   sse2_tail16
+sse2_tail8:
+	CMPQ CX, $8
+	JB   sse2_tail4
+	MOVQ AX, DX
+	SHLQ $32, DX
+	ORQ  AX, DX
+	XORQ DX, (DI)
+	ADDQ $8, DI
+	SUBQ $8, CX
+sse2_tail4:
+	CMPQ CX, $4
+	JB   sse2_tail1
+	XORL AX, (DI)
+	ADDQ $4, DI
+	SUBQ $4, CX
+sse2_tail1:
+	TESTQ CX, CX
+	JZ    sse2_done
+	XORB  AL, (DI)
+	INCQ  DI
+	SHRL  $8, AX
+	DECQ  CX
+	JMP   sse2_tail1
+sse2_done:
+	RET
+
+// func maskAVX2(p *byte, n int, key uint32)
+TEXT ·maskAVX2(SB), NOSPLIT, $0-20
+	MOVQ p+0(FP), DI
+	MOVQ n+8(FP), CX
+	MOVL key+16(FP), AX
+	MOVQ AX, X0
+	PSHUFD $0, X0, X0
+	CMPQ CX, $32
+	JB   avx2_tail16
+	VPBROADCASTD X0, Y0
+
+avx2_loop128:
+	CMPQ    CX, $128
+	JB      avx2_loop32
+	VPXOR   (DI), Y0, Y1
+	VPXOR   32(DI), Y0, Y2
+	VPXOR   64(DI), Y0, Y3
+	VPXOR   96(DI), Y0, Y4
+	VMOVDQU Y1, (DI)
+	VMOVDQU Y2, 32(DI)
+	VMOVDQU Y3, 64(DI)
+	VMOVDQU Y4, 96(DI)
+	ADDQ    $128, DI
+	SUBQ    $128, CX
+	JMP     avx2_loop128
+
+avx2_loop32:
+	CMPQ    CX, $32
+	JB      avx2_vzeroupper
+	VPXOR   (DI), Y0, Y1
+	VMOVDQU Y1, (DI)
+	ADDQ    $32, DI
+	SUBQ    $32, CX
+	JMP     avx2_loop32
+
+avx2_vzeroupper:
+	VZEROUPPER
+
+avx2_tail16:
+	CMPQ CX, $16
+	JB   avx2_tail8
+	MOVOU (DI), X1
+	PXOR  X0, X1
+	MOVOU X1, (DI)
+	ADDQ  $16, DI
+	SUBQ  $16, CX
+	JMP   avx2_tail16
+avx2_tail8:
+	CMPQ CX, $8
+	JB   avx2_tail4
+	MOVQ AX, DX
+	SHLQ $32, DX
+	ORQ  AX, DX
+	XORQ DX, (DI)
+	ADDQ $8, DI
+	SUBQ $8, CX
+avx2_tail4:
+	CMPQ CX, $4
+	JB   avx2_tail1
+	XORL AX, (DI)
+	ADDQ $4, DI
+	SUBQ $4, CX
+avx2_tail1:
+	TESTQ CX, CX
+	JZ    avx2_done
+	XORB  AL, (DI)
+	INCQ  DI
+	SHRL  $8, AX
+	DECQ  CX
+	JMP   avx2_tail1
+avx2_done:
+	RET
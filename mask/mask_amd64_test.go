@@ -0,0 +1,57 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !purego
+
+package mask
+
+import (
+	"bytes"
+	"testing"
+)
+
+// SSE2和AVX2分开测试, 不管init选了哪个
+func Test_Mask_AMD64(t *testing.T) {
+	impls := map[string]func([]byte, uint32){"sse2": maskAsmSSE2}
+	if hasAVX2 {
+		impls["avx2"] = maskAsmAVX2
+	} else {
+		t.Log("cpu不支持AVX2, 只测试SSE2")
+	}
+
+	key := uint32(0xA1B2C3D4)
+	for i := 0; i < 1000*4; i++ {
+		want := make([]byte, i)
+		for j := 0; j < len(want); j++ {
+			want[j] = byte(j * 7)
+		}
+		payload := append([]byte(nil), want...)
+		maskSlow(want, key)
+
+		for _, off := range []int{0, 1, 3} {
+			for name, mask := range impls {
+				// 前后各留一个字节, 检查有没有越界写
+				buf := make([]byte, i+off+2)
+				copy(buf[off+1:], payload)
+				mask(buf[off+1:off+1+i], key)
+				if !bytes.Equal(buf[off+1:off+1+i], want) {
+					t.Fatalf("%s: i = %d, off = %d, got %v, want %v", name, i, off, buf[off+1:off+1+i], want)
+				}
+				if buf[off] != 0 || buf[off+1+i] != 0 {
+					t.Fatalf("%s: i = %d, off = %d, write out of range", name, i, off)
+				}
+			}
+		}
+	}
+}
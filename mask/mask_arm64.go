@@ -0,0 +1,30 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !purego
+
+package mask
+
+//go:noescape
+func maskNEON(p *byte, n int, key uint32)
+
+func maskAsmNEON(payload []byte, key uint32) {
+	if len(payload) == 0 {
+		return
+	}
+	maskNEON(&payload[0], len(payload), key)
+}
+
+// arm64都支持NEON(ASIMD), 不用检查
+var maskAsm = maskAsmNEON
@@ -0,0 +1,77 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !purego
+
+#include "textflag.h"
+
+// 寄存器: R0 数据的地址, R1 剩余的长度, R2 key, V0 4个key
+// 前面处理的长度都是4的倍数, 尾巴从key的第一个字节开始
+
+// func maskNEON(p *byte, n int, key uint32)
+TEXT ·maskNEON(SB), NOSPLIT, $0-20
+	MOVD  p+0(FP), R0
+	MOVD  n+8(FP), R1
+	MOVWU key+16(FP), R2
+	VDUP  R2, V0.S4
+
+loop64:
+	CMP  $64, R1
+	BLT  loop16
+	VLD1 (R0), [V1.B16, V2.B16, V3.B16, V4.B16]
+	VEOR V0.B16, V1.B16, V1.B16
+	VEOR V0.B16, V2.B16, V2.B16
+	VEOR V0.B16, V3.B16, V3.B16
+	VEOR V0.B16, V4.B16, V4.B16
+	VST1.P [V1.B16, V2.B16, V3.B16, V4.B16], 64(R0)
+	SUB  $64, R1
+	B    loop64
+
+loop16:
+	CMP  $16, R1
+	BLT  tail8
+	VLD1 (R0), [V1.B16]
+	VEOR V0.B16, V1.B16, V1.B16
+	VST1.P [V1.B16], 16(R0)
+	SUB  $16, R1
+	B    loop16
+
+tail8:
+	CMP   $8, R1
+	BLT   tail4
+	ORR   R2<<32, R2, R3
+	MOVD  (R0), R4
+	EOR   R3, R4, R4
+	MOVD.P R4, 8(R0)
+	SUB   $8, R1
+
+tail4:
+	CMP   $4, R1
+	BLT   tail1
+	MOVWU (R0), R4
+	EORW  R2, R4, R4
+	MOVW.P R4, 4(R0)
+	SUB   $4, R1
+
+tail1:
+	CBZ   R1, done
+	MOVBU (R0), R4
+	EORW  R2, R4, R4
+	MOVB.P R4, 1(R0)
+	LSRW  $8, R2, R2
+	SUB   $1, R1
+	B     tail1
+
+done:
+	RET
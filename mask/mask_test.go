@@ -15,6 +15,7 @@ package mask
 
 import (
 	"bytes"
+	"encoding/binary"
 	"testing"
 )
 
@@ -42,3 +43,151 @@ func Test_Mask(t *testing.T) {
 // TODO 边界测试
 func Test_Mask_Boundary(t *testing.T) {
 }
+
+// 和其他库的实现交叉检查, 汇编实现也在里面, 数据的起始地址不对齐
+func Test_Mask_Cross(t *testing.T) {
+	key := uint32(0x12345678)
+	var keyBytes [4]byte
+	binary.LittleEndian.PutUint32(keyBytes[:], key)
+
+	impls := map[string]func(b []byte){
+		"fast":    func(b []byte) { maskFast(b, key) },
+		"mask":    func(b []byte) { Mask(b, key) },
+		"gorilla": func(b []byte) { maskBytes(keyBytes, 0, b) },
+		"gobwas":  func(b []byte) { Cipher(b, keyBytes, 0) },
+		"gws":     func(b []byte) { MaskXOR(b, keyBytes[:]) },
+		"nhooyr":  func(b []byte) { maskNhooyr(key, b) },
+	}
+	if maskAsm != nil {
+		impls["asm"] = func(b []byte) { maskAsm(b, key) }
+	}
+
+	for i := 0; i < 1000*4; i++ {
+		want := make([]byte, i)
+		for j := 0; j < len(want); j++ {
+			want[j] = byte(j)
+		}
+		payload := append([]byte(nil), want...)
+		maskSlow(want, key)
+
+		for _, off := range []int{0, 1, 7} {
+			for name, mask := range impls {
+				buf := make([]byte, i+off)[off:]
+				copy(buf, payload)
+				mask(buf)
+				if !bytes.Equal(buf, want) {
+					t.Fatalf("%s: i = %d, off = %d, got %v, want %v", name, i, off, buf, want)
+				}
+			}
+		}
+	}
+}
+
+func Test_MaskTo(t *testing.T) {
+	key := uint32(0x12345678)
+	for i := 0; i < 1000; i++ {
+		src := make([]byte, i)
+		for j := 0; j < len(src); j++ {
+			src[j] = byte(j)
+		}
+		orig := append([]byte(nil), src...)
+
+		want := append([]byte(nil), src...)
+		maskSlow(want, key)
+
+		// dst不对齐的情况
+		for _, off := range []int{0, 1, 3} {
+			for name, maskTo := range map[string]func(dst, src []byte, key uint32){"fast": maskToFast, "slow": maskToSlow} {
+				dst := make([]byte, i+off+2)[off:]
+				maskTo(dst, src, key)
+				if !bytes.Equal(dst[:i], want) {
+					t.Fatalf("%s: i = %d, off = %d, got %v, want %v", name, i, off, dst[:i], want)
+				}
+			}
+		}
+
+		if !bytes.Equal(src, orig) {
+			t.Fatalf("i = %d, src was modified", i)
+		}
+	}
+}
+
+func Test_MaskToWithOffset(t *testing.T) {
+	key := uint32(0xA1B2C3D4)
+	src := make([]byte, 4099)
+	for j := range src {
+		src[j] = byte(j * 7)
+	}
+	want := append([]byte(nil), src...)
+	maskSlow(want, key)
+
+	// 切成大小不一样的块, 结果和一次mask一样
+	for _, chunk := range []int{1, 2, 3, 5, 7, 64, 1000} {
+		dst := make([]byte, len(src))
+		pos := 0
+		for i := 0; i < len(src); i += chunk {
+			end := i + chunk
+			if end > len(src) {
+				end = len(src)
+			}
+			pos = MaskToWithOffset(dst[i:end], src[i:end], key, pos)
+		}
+
+		if !bytes.Equal(dst, want) {
+			t.Fatalf("chunk = %d, mismatch", chunk)
+		}
+		if pos != len(src)&3 {
+			t.Fatalf("chunk = %d, pos = %d", chunk, pos)
+		}
+	}
+}
+
+// go test -fuzz=FuzzMask ./mask
+// 所有的实现和maskSlow逐字节比较, off控制数据起始地址的对齐
+func FuzzMask(f *testing.F) {
+	for _, n := range []int{0, 1, 3, 4, 7, 8, 15, 16, 31, 64, 127, 128, 129, 1000} {
+		payload := make([]byte, n)
+		for i := range payload {
+			payload[i] = byte(i)
+		}
+		f.Add(payload, uint32(0x12345678), uint8(n%8))
+	}
+
+	f.Fuzz(func(t *testing.T, payload []byte, key uint32, off uint8) {
+		o := int(off % 8)
+		want := append([]byte(nil), payload...)
+		maskSlow(want, key)
+
+		impls := map[string]func(b []byte){
+			"fast": func(b []byte) { maskFast(b, key) },
+			"mask": func(b []byte) { Mask(b, key) },
+			"to": func(b []byte) {
+				src := append([]byte(nil), b...)
+				maskToFast(b, src, key)
+			},
+		}
+		if maskAsm != nil {
+			impls["asm"] = func(b []byte) { maskAsm(b, key) }
+		}
+
+		for name, mask := range impls {
+			buf := make([]byte, o+len(payload))[o:]
+			copy(buf, payload)
+			mask(buf)
+			if !bytes.Equal(buf, want) {
+				t.Fatalf("%s: len = %d, off = %d, got %v, want %v", name, len(payload), o, buf, want)
+			}
+		}
+	})
+}
+
+// 不能每次都一样, 连续的100个里面不应该有重复的
+func Test_NewKey(t *testing.T) {
+	seen := make(map[uint32]bool)
+	for i := 0; i < 100; i++ {
+		seen[NewKey()] = true
+	}
+	if len(seen) < 99 {
+		t.Fatalf("got %d distinct keys out of 100", len(seen))
+	}
+}
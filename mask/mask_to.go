@@ -0,0 +1,85 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package mask
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"unsafe"
+)
+
+// 把src mask之后写到dst, dst的长度不能小于src, src不会被修改
+// 拷贝和mask一次完成, 不需要先拷贝再调用Mask
+var MaskTo func(dst, src []byte, key uint32)
+
+// 同MaskTo, pos是src第一个字节对应的mask key下标(0-3), 分块mask的时候使用
+// 返回下一块的pos
+func MaskToWithOffset(dst, src []byte, key uint32, pos int) int {
+	MaskTo(dst, src, rotateKey(key, pos))
+	return (pos + len(src)) & 3
+}
+
+// key是小端序的4个字节, 从第pos个字节开始, 相当于右移pos个字节
+func rotateKey(key uint32, pos int) uint32 {
+	return bits.RotateLeft32(key, -8*(pos&3))
+}
+
+//go:nosplit
+func maskToFast(dst, src []byte, key uint32) {
+	n := len(src)
+	if n == 0 {
+		return
+	}
+	_ = dst[n-1]
+
+	d := unsafe.Pointer(unsafe.SliceData(dst))
+	s := unsafe.Pointer(unsafe.SliceData(src))
+	i := 0
+	if n >= 8 {
+		key64 := uint64(key)<<32 | uint64(key)
+		for ; i+64 <= n; i += 64 {
+			*(*uint64)(unsafe.Add(d, i)) = *(*uint64)(unsafe.Add(s, i)) ^ key64
+			*(*uint64)(unsafe.Add(d, i+8)) = *(*uint64)(unsafe.Add(s, i+8)) ^ key64
+			*(*uint64)(unsafe.Add(d, i+16)) = *(*uint64)(unsafe.Add(s, i+16)) ^ key64
+			*(*uint64)(unsafe.Add(d, i+24)) = *(*uint64)(unsafe.Add(s, i+24)) ^ key64
+			*(*uint64)(unsafe.Add(d, i+32)) = *(*uint64)(unsafe.Add(s, i+32)) ^ key64
+			*(*uint64)(unsafe.Add(d, i+40)) = *(*uint64)(unsafe.Add(s, i+40)) ^ key64
+			*(*uint64)(unsafe.Add(d, i+48)) = *(*uint64)(unsafe.Add(s, i+48)) ^ key64
+			*(*uint64)(unsafe.Add(d, i+56)) = *(*uint64)(unsafe.Add(s, i+56)) ^ key64
+		}
+
+		for ; i+8 <= n; i += 8 {
+			*(*uint64)(unsafe.Add(d, i)) = *(*uint64)(unsafe.Add(s, i)) ^ key64
+		}
+	}
+
+	if i+4 <= n {
+		*(*uint32)(unsafe.Add(d, i)) = *(*uint32)(unsafe.Add(s, i)) ^ key
+		i += 4
+	}
+
+	// 剩下的不到4个字节, i是4的倍数, 从key的第一个字节开始
+	for ; i < n; i++ {
+		dst[i] = src[i] ^ byte(key>>(8*(i&3)))
+	}
+}
+
+func maskToSlow(dst, src []byte, key uint32) {
+	var maskVal [4]byte
+	binary.LittleEndian.PutUint32(maskVal[:], key)
+	dst = dst[:len(src)]
+	for i := 0; i < len(src); i++ {
+		dst[i] = src[i] ^ maskVal[i%4]
+	}
+}
@@ -0,0 +1,17 @@
+module github.com/antlabs/wsutil/testdata/capture
+
+go 1.23
+
+require (
+	github.com/antlabs/wsutil v0.0.0
+	github.com/coder/websocket v1.8.15
+	github.com/gorilla/websocket v1.5.3
+	github.com/lxzan/gws v1.8.9
+)
+
+require (
+	github.com/dolthub/maphash v0.1.0 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+)
+
+replace github.com/antlabs/wsutil => ../..
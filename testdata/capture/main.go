@@ -0,0 +1,377 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// capture 在本机用gorilla/websocket, coder/websocket, gws和node的WebSocket互相连接,
+// 抓取原始的握手和frame, 生成各个fuzz测试的capture_开头的种子语料.
+// 这些实现都开启了permessage-deflate, 所以语料里面有真实的Sec-WebSocket-Extensions和压缩过的payload.
+//
+// 重新生成(需要node 20以上):
+//
+//	cd testdata/capture && go run .
+//
+// 已经存在的capture_种子会先删掉, 和其他种子(synthetic_开头的)内容一样的不会再写.
+// Sec-WebSocket-Key和客户端的mask key是随机的, 所以客户端方向的种子每次生成都不一样.
+//
+// 放在testdata下面并且是单独的module, 主module的go build ./...和依赖都不会包含它.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/antlabs/wsutil/enum"
+	"github.com/antlabs/wsutil/frame"
+	"github.com/antlabs/wsutil/mask"
+	cws "github.com/coder/websocket"
+	gorilla "github.com/gorilla/websocket"
+	"github.com/lxzan/gws"
+)
+
+// 仓库的根目录
+const root = "../.."
+
+// 每个客户端发的消息, 服务端原样返回
+var messages [][]byte
+
+func init() {
+	txt, err := os.ReadFile(filepath.Join(root, "testdata/1.txt"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	n := 1500
+	for !utf8.Valid(txt[:n]) {
+		n--
+	}
+	messages = [][]byte{[]byte("Hello"), txt[:n], txt[:n]}
+}
+
+func gorillaServer() http.Handler {
+	up := gorilla.Upgrader{EnableCompression: true}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := up.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.EnableWriteCompression(true)
+		for {
+			mt, p, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			c.WriteMessage(mt, p)
+		}
+	})
+}
+
+func coderServer() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := cws.Accept(w, r, &cws.AcceptOptions{CompressionMode: cws.CompressionContextTakeover, CompressionThreshold: 1})
+		if err != nil {
+			return
+		}
+		defer c.CloseNow()
+		ctx := context.Background()
+		for {
+			mt, p, err := c.Read(ctx)
+			if err != nil {
+				return
+			}
+			c.Write(ctx, mt, p)
+		}
+	})
+}
+
+type gwsEcho struct{ gws.BuiltinEventHandler }
+
+func (gwsEcho) OnMessage(c *gws.Conn, m *gws.Message) {
+	defer m.Close()
+	c.WriteMessage(m.Opcode, m.Bytes())
+}
+
+func gwsServer() http.Handler {
+	up := gws.NewUpgrader(gwsEcho{}, &gws.ServerOption{
+		PermessageDeflate: gws.PermessageDeflate{Enabled: true, ServerContextTakeover: true, ClientContextTakeover: true, Threshold: 1},
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := up.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		c.ReadLoop()
+	})
+}
+
+func gorillaClient(u string) error {
+	d := gorilla.Dialer{EnableCompression: true}
+	c, _, err := d.Dial(u, nil)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	c.EnableWriteCompression(true)
+	for _, m := range messages {
+		if err := c.WriteMessage(gorilla.TextMessage, m); err != nil {
+			return err
+		}
+		if _, _, err := c.ReadMessage(); err != nil {
+			return err
+		}
+	}
+	c.WriteMessage(gorilla.CloseMessage, gorilla.FormatCloseMessage(1000, ""))
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		if _, _, err := c.ReadMessage(); err != nil {
+			return nil
+		}
+	}
+}
+
+func coderClient(u string) error {
+	ctx := context.Background()
+	c, _, err := cws.Dial(ctx, u, &cws.DialOptions{CompressionMode: cws.CompressionContextTakeover, CompressionThreshold: 1})
+	if err != nil {
+		return err
+	}
+	for _, m := range messages {
+		if err := c.Write(ctx, cws.MessageText, m); err != nil {
+			return err
+		}
+		if _, _, err := c.Read(ctx); err != nil {
+			return err
+		}
+	}
+	return c.Close(cws.StatusNormalClosure, "")
+}
+
+const nodeScript = `
+const ws = new WebSocket(process.argv[1]);
+const msgs = JSON.parse(process.argv[2]);
+let i = 0;
+ws.onopen = () => ws.send(msgs[i]);
+ws.onmessage = () => { i++; if (i < msgs.length) ws.send(msgs[i]); else ws.close(1000); };
+ws.onclose = () => process.exit(0);
+ws.onerror = (e) => { console.error(e.message); process.exit(1); };
+`
+
+func nodeClient(u string) error {
+	var js bytes.Buffer
+	js.WriteString("[")
+	for i, m := range messages {
+		if i > 0 {
+			js.WriteString(",")
+		}
+		fmt.Fprintf(&js, "%q", m)
+	}
+	js.WriteString("]")
+	cmd := exec.Command("node", "--no-warnings", "--experimental-websocket", "-e", nodeScript, u, js.String())
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// 客户端连到这个代理, 代理再连到服务端, 两个方向的数据都记下来
+func record(backend string) (addr string, c2s, s2c *bytes.Buffer, done chan struct{}) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	c2s, s2c = &bytes.Buffer{}, &bytes.Buffer{}
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		c, err := ln.Accept()
+		ln.Close()
+		if err != nil {
+			return
+		}
+		s, err := net.Dial("tcp", backend)
+		if err != nil {
+			c.Close()
+			return
+		}
+		var wg sync.WaitGroup
+		wg.Add(2)
+		pipe := func(dst, src net.Conn, buf *bytes.Buffer) {
+			defer wg.Done()
+			io.Copy(io.MultiWriter(dst, buf), src)
+			dst.(*net.TCPConn).CloseWrite()
+		}
+		go pipe(s, c, c2s)
+		go pipe(c, s, s2c)
+		wg.Wait()
+		c.Close()
+		s.Close()
+	}()
+	return ln.Addr().String(), c2s, s2c, done
+}
+
+// 种子语料的目录, 写之前删掉旧的capture_种子, 记下其他种子的内容用来去重
+type corpus struct {
+	dir  string
+	seen map[string]bool
+}
+
+var corpora = map[string]*corpus{}
+
+func open(dir string) *corpus {
+	if c, ok := corpora[dir]; ok {
+		return c
+	}
+	c := &corpus{dir: filepath.Join(root, dir), seen: map[string]bool{}}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		log.Fatal(err)
+	}
+	old, _ := filepath.Glob(filepath.Join(c.dir, "capture_*"))
+	for _, p := range old {
+		os.Remove(p)
+	}
+	rest, _ := filepath.Glob(filepath.Join(c.dir, "*"))
+	for _, p := range rest {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			log.Fatal(err)
+		}
+		c.seen[string(data)] = true
+	}
+	corpora[dir] = c
+	return c
+}
+
+func write(dir, name string, args ...string) {
+	c := open(dir)
+	data := "go test fuzz v1\n" + strings.Join(args, "\n") + "\n"
+	if c.seen[data] {
+		return
+	}
+	c.seen[data] = true
+	if err := os.WriteFile(filepath.Join(c.dir, name), []byte(data), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func b(p []byte) string { return "[]byte(" + strconv.Quote(string(p)) + ")" }
+func s(v string) string { return "string(" + strconv.Quote(v) + ")" }
+
+// 从一次抓包里面生成种子, name是client_to_server
+func gen(name string, c2s, s2c []byte, exts map[string]string, seenHead map[string]bool) {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(c2s)))
+	if err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+	rsp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(s2c)), req)
+	if err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+	reqEnd := bytes.Index(c2s, []byte("\r\n\r\n")) + 4
+	rspEnd := bytes.Index(s2c, []byte("\r\n\r\n")) + 4
+
+	client, server, _ := strings.Cut(name, "_to_")
+	exts["capture_"+client+"_offer"] = req.Header.Get("Sec-WebSocket-Extensions")
+	exts["capture_"+server+"_response_to_"+client] = rsp.Header.Get("Sec-WebSocket-Extensions")
+
+	write("handshake/testdata/fuzz/FuzzCheckRequest", "capture_"+name, b(c2s[:reqEnd]))
+	write("handshake/testdata/fuzz/FuzzReadResponse", "capture_"+name, s(req.Header.Get("Sec-WebSocket-Key")), b(s2c))
+
+	for _, dir := range []struct {
+		tag    string
+		frames []byte
+	}{{"client", c2s[reqEnd:]}, {"server", s2c[rspEnd:]}} {
+		write("frame/testdata/fuzz/FuzzReadFrameFromWindowsV2", "capture_"+name+"_"+dir.tag, b(dir.frames))
+
+		r := bytes.NewReader(dir.frames)
+		var headArray [enum.MaxFrameHeaderSize]byte
+		for i := 0; ; i++ {
+			off := len(dir.frames) - r.Len()
+			h, size, err := frame.ReadHeader(r, &headArray)
+			if err != nil {
+				break
+			}
+			payload := make([]byte, h.PayloadLen)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				break
+			}
+			head := dir.frames[off : off+size]
+			// 同一种header只留一个: 第一个字节, 长度的编码方式, 有没有mask
+			shape := fmt.Sprintf("%x-%d-%v", head[0], size, h.Mask)
+			if !seenHead[shape] {
+				seenHead[shape] = true
+				write("frame/testdata/fuzz/FuzzReadHeader", fmt.Sprintf("capture_%s_%s_%d", name, dir.tag, i), b(head))
+			}
+			if h.Mask {
+				mask.Mask(payload, h.MaskKey)
+			}
+			if h.GetRsv1() {
+				write("deflate/testdata/fuzz/FuzzDecompress", fmt.Sprintf("capture_%s_%s_%d", name, dir.tag, i), b(payload))
+			}
+		}
+	}
+}
+
+func main() {
+	servers := map[string]http.Handler{"gorilla": gorillaServer(), "coder": coderServer(), "gws": gwsServer()}
+	clients := map[string]func(string) error{"gorilla": gorillaClient, "coder": coderClient, "node": nodeClient}
+	pairs := [][2]string{{"coder", "gorilla"}, {"gorilla", "coder"}, {"gorilla", "gws"}, {"node", "coder"}, {"node", "gorilla"}, {"node", "gws"}}
+
+	exts := map[string]string{}
+	seenHead := map[string]bool{}
+	for _, p := range pairs {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			log.Fatal(err)
+		}
+		srv := &http.Server{Handler: servers[p[1]]}
+		go srv.Serve(ln)
+
+		addr, c2s, s2c, done := record(ln.Addr().String())
+		if err := clients[p[0]]("ws://" + addr + "/"); err != nil {
+			log.Fatalf("%s -> %s: %v", p[0], p[1], err)
+		}
+		select {
+		case <-done:
+		case <-time.After(3 * time.Second):
+			log.Fatalf("%s -> %s: timeout", p[0], p[1])
+		}
+		srv.Close()
+
+		name := p[0] + "_to_" + p[1]
+		gen(name, c2s.Bytes(), s2c.Bytes(), exts, seenHead)
+		fmt.Println(name, c2s.Len(), s2c.Len())
+	}
+
+	keys := make([]string, 0, len(exts))
+	for k := range exts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v := exts[k]; v != "" {
+			write("deflate/testdata/fuzz/FuzzParseExtensions", k, s(v))
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package utf8check
+
+import (
+	"bytes"
+	"testing"
+	"unicode/utf8"
+)
+
+var (
+	benchASCII = bytes.Repeat([]byte("hello world 1234"), 64)
+	benchChina = bytes.Repeat([]byte("中文测试"), 85)
+)
+
+func Benchmark_Checker_ASCII_1024(b *testing.B) {
+	b.SetBytes(int64(len(benchASCII)))
+	for i := 0; i < b.N; i++ {
+		var c Checker
+		if c.Feed(benchASCII) != nil {
+			b.Fatal("invalid")
+		}
+	}
+}
+
+func Benchmark_Utf8Valid_ASCII_1024(b *testing.B) {
+	b.SetBytes(int64(len(benchASCII)))
+	for i := 0; i < b.N; i++ {
+		if !utf8.Valid(benchASCII) {
+			b.Fatal("invalid")
+		}
+	}
+}
+
+func Benchmark_Checker_China_1020(b *testing.B) {
+	b.SetBytes(int64(len(benchChina)))
+	for i := 0; i < b.N; i++ {
+		var c Checker
+		if c.Feed(benchChina) != nil {
+			b.Fatal("invalid")
+		}
+	}
+}
+
+func Benchmark_Utf8Valid_China_1020(b *testing.B) {
+	b.SetBytes(int64(len(benchChina)))
+	for i := 0; i < b.N; i++ {
+		if !utf8.Valid(benchChina) {
+			b.Fatal("invalid")
+		}
+	}
+}
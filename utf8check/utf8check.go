@@ -0,0 +1,170 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package utf8check
+
+import (
+	"encoding/binary"
+
+	"github.com/antlabs/wsutil/closecode"
+)
+
+// text消息里面有非法的utf-8, 需要使用1007关闭连接
+var ErrInvalidUTF8 = &closecode.CloseError{Code: closecode.InvalidFramePayloadData, Reason: "invalid utf-8"}
+
+const asciiMask = 0x8080808080808080
+
+// 首字节的信息, 低4位是还需要的后续字节数, 高4位是第一个后续字节的范围(acceptRanges的下标)
+// 0表示ascii, invalid表示不能作为首字节
+const invalid = 0xFF
+
+var first = func() (t [256]uint8) {
+	for i := 0x80; i < 256; i++ {
+		switch {
+		case i >= 0xC2 && i <= 0xDF:
+			t[i] = 1
+		case i == 0xE0:
+			// 过长编码
+			t[i] = 1<<4 | 2
+		case i == 0xED:
+			// 代理区 U+D800-U+DFFF
+			t[i] = 2<<4 | 2
+		case i >= 0xE1 && i <= 0xEF:
+			t[i] = 2
+		case i == 0xF0:
+			t[i] = 3<<4 | 3
+		case i >= 0xF1 && i <= 0xF3:
+			t[i] = 3
+		case i == 0xF4:
+			// 不能大于U+10FFFF
+			t[i] = 4<<4 | 3
+		default:
+			t[i] = invalid
+		}
+	}
+	return t
+}()
+
+type acceptRange struct {
+	lo, hi byte
+}
+
+var acceptRanges = [...]acceptRange{
+	{lo: 0x80, hi: 0xBF},
+	{lo: 0xA0, hi: 0xBF},
+	{lo: 0x80, hi: 0x9F},
+	{lo: 0x90, hi: 0xBF},
+	{lo: 0x80, hi: 0x8F},
+}
+
+// Checker 流式的utf-8检查
+// 一个字符可能被切到多个frame里面, 所以每个frame单独调用utf8.Valid是不对的
+// Checker会记住上一段数据末尾没有结束的字符, 下一段数据接着检查
+//
+// 合法的字节序列见 https://datatracker.ietf.org/doc/html/rfc3629#section-4
+type Checker struct {
+	need   uint8 // 当前字符还需要几个后续字节
+	lo, hi byte  // 下一个后续字节的合法范围
+}
+
+// 检查一段数据, 碰到非法的字节马上返回错误, 不用等整个消息收完
+func (c *Checker) Feed(p []byte) error {
+	// 先把上一段数据没有结束的字符处理完
+	for c.need > 0 && len(p) > 0 {
+		if p[0] < c.lo || p[0] > c.hi {
+			return ErrInvalidUTF8
+		}
+		c.lo, c.hi = 0x80, 0xBF
+		c.need--
+		p = p[1:]
+	}
+
+	for len(p) > 0 {
+		// ascii快速路径, 一次检查16个字节, 不够16个字节再检查8个字节
+		for len(p) >= 16 && (binary.LittleEndian.Uint64(p)|binary.LittleEndian.Uint64(p[8:]))&asciiMask == 0 {
+			p = p[16:]
+		}
+		if len(p) >= 8 && binary.LittleEndian.Uint64(p)&asciiMask == 0 {
+			p = p[8:]
+			continue
+		}
+		if len(p) == 0 {
+			break
+		}
+
+		x := first[p[0]]
+		if x == 0 {
+			p = p[1:]
+			continue
+		}
+		if x == invalid {
+			return ErrInvalidUTF8
+		}
+
+		need := int(x & 0xF)
+		accept := acceptRanges[x>>4]
+		if len(p) > need {
+			// 整个字符都在这段数据里面
+			if p[1] < accept.lo || p[1] > accept.hi {
+				return ErrInvalidUTF8
+			}
+			if need >= 2 && p[2]&0xC0 != 0x80 {
+				return ErrInvalidUTF8
+			}
+			if need == 3 && p[3]&0xC0 != 0x80 {
+				return ErrInvalidUTF8
+			}
+			p = p[need+1:]
+			continue
+		}
+
+		// 字符被切断了, 检查已有的字节, 剩下的等下一段数据
+		lo, hi := accept.lo, accept.hi
+		for i := 1; i < len(p); i++ {
+			if p[i] < lo || p[i] > hi {
+				return ErrInvalidUTF8
+			}
+			lo, hi = 0x80, 0xBF
+		}
+		c.need, c.lo, c.hi = uint8(need-len(p)+1), lo, hi
+		return nil
+	}
+	return nil
+}
+
+// 实现io.Writer接口, 方便和io.TeeReader, io.MultiWriter一起使用
+func (c *Checker) Write(p []byte) (n int, err error) {
+	if err = c.Feed(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// 消息结束的时候调用, 末尾不能有没结束的字符
+func (c *Checker) Finish() error {
+	if c.need > 0 {
+		c.Reset()
+		return ErrInvalidUTF8
+	}
+	return nil
+}
+
+func (c *Checker) Reset() {
+	c.need = 0
+}
+
+// 检查一个完整的消息
+func Valid(p []byte) bool {
+	var c Checker
+	return c.Feed(p) == nil && c.Finish() == nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2021-2024 antlabs. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package utf8check
+
+import (
+	"math/rand"
+	"testing"
+	"unicode/utf8"
+)
+
+var testUTF8Data = [][]byte{
+	[]byte("hello world"),
+	[]byte("κόσμε"),
+	[]byte("中文测试, 一段比较长的中文, 超过8个字节"),
+	[]byte("emoji 😀 in the middle"),
+	[]byte("\xed\x9f\xbf"),         // U+D7FF
+	[]byte("\xee\x80\x80"),         // U+E000
+	[]byte("\xf4\x8f\xbf\xbf"),     // U+10FFFF
+	[]byte("\xc0\xaf"),             // 过长编码
+	[]byte("\xe0\x80\xaf"),         // 过长编码
+	[]byte("\xed\xa0\x80"),         // 代理区
+	[]byte("\xf4\x90\x80\x80"),     // > U+10FFFF
+	[]byte("\xf5\x80\x80\x80"),     // 非法首字节
+	[]byte("\xce\xba\xe1\xbd"),     // 末尾不完整
+	[]byte("abcdefgh\x80abcdefgh"), // 单独的后续字节
+	[]byte("\xce\xba\xe1\xbd\xb9\xcf\x83\xce\xbc\xce\xb5\xed\xa0\x80\x65\x64\x69\x74\x65\x64"),
+}
+
+// 切成两段输入, 结果要和utf8.Valid一样
+func Test_Checker_Split(t *testing.T) {
+	for i, data := range testUTF8Data {
+		want := utf8.Valid(data)
+		for split := 0; split <= len(data); split++ {
+			var c Checker
+			err := c.Feed(data[:split])
+			if err == nil {
+				err = c.Feed(data[split:])
+			}
+			if err == nil {
+				err = c.Finish()
+			}
+
+			if (err == nil) != want {
+				t.Fatalf("index:%d, split:%d, got %v, want valid = %v", i, split, err, want)
+			}
+		}
+	}
+}
+
+// 一个字节一个字节的输入
+func Test_Checker_ByteByByte(t *testing.T) {
+	for i, data := range testUTF8Data {
+		var c Checker
+		var err error
+		for j := 0; j < len(data) && err == nil; j++ {
+			err = c.Feed(data[j : j+1])
+		}
+		if err == nil {
+			err = c.Finish()
+		}
+		if (err == nil) != utf8.Valid(data) {
+			t.Fatalf("index:%d, got %v, want valid = %v", i, err, utf8.Valid(data))
+		}
+	}
+}
+
+func Test_Checker_Random(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	alphabet := []byte{'a', 0x80, 0xBF, 0xC2, 0xDF, 0xE0, 0xED, 0xEF, 0xF0, 0xF4, 0xF5, 0xFF, 0x90, 0x9F, 0xA0}
+	for i := 0; i < 100000; i++ {
+		data := make([]byte, r.Intn(24))
+		for j := range data {
+			data[j] = alphabet[r.Intn(len(alphabet))]
+		}
+		if Valid(data) != utf8.Valid(data) {
+			t.Fatalf("%x: got %v, want %v", data, Valid(data), utf8.Valid(data))
+		}
+	}
+}